@@ -0,0 +1,382 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxAlbumNameLength = 200
+	// Maximum number of images added or ordered in one request
+	maxAlbumBatchSize = 500
+)
+
+var (
+	ErrImageNotInAlbum = errors.New("image is not in the album")
+	ErrUnknownImage = errors.New("unknown image")
+	ErrInvalidAlbumOrder = errors.New("order must list every image of the album exactly once")
+)
+
+type Album struct {
+	ID string `json:"id"`
+	UserId string `json:"user_id"`
+	Name string `json:"name"`
+	Description string `json:"description"`
+	// Selected cover, the first image of the album is used when null
+	CoverImageID sql.NullString `json:"cover_image_id"`
+	// Storage key of the cover's thumbnail, empty for empty albums
+	CoverThumbnail string `json:"cover_thumbnail,omitempty"`
+	ImageCount int `json:"image_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type AlbumBody struct {
+	Name string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AlbumUpdate holds the fields of a partial album update, nil fields are left unchanged.
+// An empty cover image ID resets the cover to the first image.
+type AlbumUpdate struct {
+	Name *string `json:"name"`
+	Description *string `json:"description"`
+	CoverImageID *string `json:"cover_image_id"`
+}
+
+type AlbumResponse struct {
+	Album Album `json:"album"`
+	Images []ImageSchema `json:"images"`
+}
+
+type AlbumImagesBody struct {
+	ImageIDs []string `json:"image_ids"`
+}
+
+type AlbumReprocessResult struct {
+	ImageID string `json:"image_id"`
+	Queued bool `json:"queued"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func validateAlbumName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAlbumNameLength {
+		return "", fmt.Errorf("name is required and must be at most %d characters", maxAlbumNameLength)
+	}
+	return name, nil
+}
+
+func decodeAlbumImagesBody(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var body AlbumImagesBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		returnAppError(w, "Invalid request body", http.StatusBadRequest, err)
+		return nil, false
+	}
+	if len(body.ImageIDs) == 0 || len(body.ImageIDs) > maxAlbumBatchSize {
+		returnAppError(w, fmt.Sprintf("image_ids must list between 1 and %d images", maxAlbumBatchSize), http.StatusBadRequest, nil)
+		return nil, false
+	}
+	return body.ImageIDs, true
+}
+
+// getAlbumFromRequest writes the error response and returns false when the album cannot be loaded
+func getAlbumFromRequest(w http.ResponseWriter, r *http.Request) (Album, bool) {
+	album, err := GetAlbum(mux.Vars(r)["album_id"], mux.Vars(r)["user_id"])
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Album not found", http.StatusNotFound, nil)
+		return album, false
+	}
+	if err != nil {
+		returnAppError(w, "Unable to get album", http.StatusInternalServerError, err)
+		return album, false
+	}
+	return album, true
+}
+
+func createAlbum(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	var body AlbumBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		returnAppError(w, "Invalid request body", http.StatusBadRequest, err)
+		return
+	}
+	name, err := validateAlbumName(body.Name)
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	description, err := validateDescription(body.Description)
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	now := time.Now()
+	album := Album{
+		ID: uuid.New().String(),
+		UserId: userId,
+		Name: name,
+		Description: description,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = InsertAlbum(album)
+	if err != nil {
+		returnAppError(w, "Unable to save album", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(album)
+}
+
+func getAlbums(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	albums, err := GetAlbums(userId)
+	if err != nil {
+		returnAppError(w, "Unable to get albums", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(albums)
+}
+
+func getAlbum(w http.ResponseWriter, r *http.Request) {
+	album, ok := getAlbumFromRequest(w, r)
+	if !ok {
+		return
+	}
+	images, err := GetAlbumImages(album.ID)
+	if err != nil {
+		returnAppError(w, "Unable to get album images", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AlbumResponse{Album: album, Images: images})
+}
+
+func updateAlbum(w http.ResponseWriter, r *http.Request) {
+	albumId := mux.Vars(r)["album_id"]
+	userId := mux.Vars(r)["user_id"]
+	var update AlbumUpdate
+	err := json.NewDecoder(r.Body).Decode(&update)
+	if err != nil {
+		returnAppError(w, "Invalid request body", http.StatusBadRequest, err)
+		return
+	}
+	if update.Name != nil {
+		name, err := validateAlbumName(*update.Name)
+		if err != nil {
+			returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+			return
+		}
+		update.Name = &name
+	}
+	if update.Description != nil {
+		description, err := validateDescription(*update.Description)
+		if err != nil {
+			returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+			return
+		}
+		update.Description = &description
+	}
+	err = UpdateAlbum(albumId, userId, update)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Album not found", http.StatusNotFound, nil)
+		return
+	}
+	if errors.Is(err, ErrImageNotInAlbum) {
+		returnAppError(w, "Cover must be an image of the album", http.StatusBadRequest, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to update album", http.StatusInternalServerError, err)
+		return
+	}
+	album, ok := getAlbumFromRequest(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(album)
+}
+
+func deleteAlbum(w http.ResponseWriter, r *http.Request) {
+	deleted, err := DeleteAlbum(mux.Vars(r)["album_id"], mux.Vars(r)["user_id"])
+	if err != nil {
+		returnAppError(w, "Unable to delete album", http.StatusInternalServerError, err)
+		return
+	}
+	if !deleted {
+		returnAppError(w, "Album not found", http.StatusNotFound, nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func addAlbumImages(w http.ResponseWriter, r *http.Request) {
+	imageIDs, ok := decodeAlbumImagesBody(w, r)
+	if !ok {
+		return
+	}
+	err := AddAlbumImages(mux.Vars(r)["album_id"], mux.Vars(r)["user_id"], imageIDs)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Album not found", http.StatusNotFound, nil)
+		return
+	}
+	if errors.Is(err, ErrUnknownImage) {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to add images to album", http.StatusInternalServerError, err)
+		return
+	}
+	getAlbum(w, r)
+}
+
+func removeAlbumImage(w http.ResponseWriter, r *http.Request) {
+	removed, err := RemoveAlbumImage(mux.Vars(r)["album_id"], mux.Vars(r)["user_id"], mux.Vars(r)["image_id"])
+	if err != nil {
+		returnAppError(w, "Unable to remove image from album", http.StatusInternalServerError, err)
+		return
+	}
+	if !removed {
+		returnAppError(w, "Image not found in album", http.StatusNotFound, nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func reorderAlbumImages(w http.ResponseWriter, r *http.Request) {
+	imageIDs, ok := decodeAlbumImagesBody(w, r)
+	if !ok {
+		return
+	}
+	err := ReorderAlbumImages(mux.Vars(r)["album_id"], mux.Vars(r)["user_id"], imageIDs)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Album not found", http.StatusNotFound, nil)
+		return
+	}
+	if errors.Is(err, ErrInvalidAlbumOrder) {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to reorder album", http.StatusInternalServerError, err)
+		return
+	}
+	getAlbum(w, r)
+}
+
+// imageStorageKey returns the key of the requested variant. The compressed variant falls back to the original until compression completed.
+func imageStorageKey(image ImageSchema, variant string) string {
+	folder := Uploads
+	if variant == "thumbnail" {
+		folder = Thumbnail
+	} else if variant != "original" && JobStatus(image.JOB_STATUS) == JobCompleted {
+		folder = Resized
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", folder, image.UserId, image.ImageID, imageObjectName(image.Filename, image.Version))
+}
+
+// downloadAlbum streams the album as a ZIP
+func downloadAlbum(w http.ResponseWriter, r *http.Request) {
+	variant := r.URL.Query().Get("variant")
+	if variant != "" && variant != "original" && variant != "compressed" {
+		returnAppError(w, "variant must be original or compressed", http.StatusBadRequest, nil)
+		return
+	}
+	album, ok := getAlbumFromRequest(w, r)
+	if !ok {
+		return
+	}
+	images, err := GetAlbumImages(album.ID)
+	if err != nil {
+		returnAppError(w, "Unable to get album images", http.StatusInternalServerError, err)
+		return
+	}
+	writeAlbumArchive(w, album, images, variant)
+}
+
+// writeAlbumArchive streams the album's images as a ZIP, entries are prefixed with their position to keep album order and unique names
+func writeAlbumArchive(w http.ResponseWriter, album Album, images []ImageSchema, variant string) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", album.ID+".zip"))
+	archive := zip.NewWriter(w)
+	for i, image := range images {
+		data, err := DownloadFileFromS3(imageStorageKey(image, variant))
+		if err != nil {
+			// Headers are already sent, the truncated archive tells the client the download failed
+			logStructured(ERROR, "Unable to download image for album archive: "+image.ImageID, err, 0, false)
+			return
+		}
+		// Images are already compressed, storing them avoids spending CPU for nothing
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name: fmt.Sprintf("%03d_%s", i+1, image.DisplayName),
+			Method: zip.Store,
+			Modified: image.CreatedAt,
+		})
+		if err != nil {
+			return
+		}
+		_, err = entry.Write(data)
+		if err != nil {
+			return
+		}
+	}
+	archive.Close()
+}
+
+// reprocessAlbum requeues every completed, failed or cancelled image of the album.
+// Images still queued or being processed are reported as skipped.
+func reprocessAlbum(w http.ResponseWriter, r *http.Request) {
+	album, ok := getAlbumFromRequest(w, r)
+	if !ok {
+		return
+	}
+	images, err := GetAlbumImages(album.ID)
+	if err != nil {
+		returnAppError(w, "Unable to get album images", http.StatusInternalServerError, err)
+		return
+	}
+	results := []AlbumReprocessResult{}
+	for _, image := range images {
+		result := AlbumReprocessResult{ImageID: image.ImageID, Queued: true}
+		err := requeueImage(image, true)
+		if errors.Is(err, ErrIllegalJobTransition) {
+			result.Queued = false
+			result.Reason = "cannot be reprocessed in status " + image.JOB_STATUS
+		} else if errors.Is(err, ErrJobNotRemovable) {
+			result.Queued = false
+			result.Reason = "previous job is still held by a worker"
+		} else if err != nil {
+			logStructured(ERROR, "Unable to reprocess album image: "+image.ImageID, err, 0, false)
+			result.Queued = false
+			result.Reason = "unable to reprocess image"
+		}
+		results = append(results, result)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/nfnt/resize"
+)
+
+const (
+	// JPEG quality is lowered by this step until the target size is reached
+	targetSizeQualityStep = 10
+	minTargetSizeQuality = 10
+)
+
+// JobProcessor handles a single job, finalAttempt is true when a failure will not be retried
+type JobProcessor func(ctx context.Context, message Message, finalAttempt bool) error
+
+// JobConsumer is implemented by brokers that can feed jobs to the built-in worker
+type JobConsumer interface {
+	ConsumeJobs(concurrency int, process JobProcessor) error
+}
+
+// cancellationChecker is implemented by brokers that let workers observe cancellations
+type cancellationChecker interface {
+	IsCancelled(imageID string) bool
+}
+
+type WorkerOptions struct {
+	Concurrency int
+	// Default JPEG quality when the upload does not specify one
+	JPEGQuality int
+	PNGCompression png.CompressionLevel
+}
+
+// StartBuiltinWorker processes jobs in this process instead of the external job executor
+func StartBuiltinWorker(options WorkerOptions) error {
+	consumer, ok := publisher.(JobConsumer)
+	if !ok {
+		return errors.New("configured broker does not support the built-in worker")
+	}
+	fmt.Println("Built-in worker started with concurrency", options.Concurrency)
+	return consumer.ConsumeJobs(options.Concurrency, func(ctx context.Context, message Message, finalAttempt bool) error {
+		return processImageJob(ctx, message, finalAttempt, options)
+	})
+}
+
+// ParsePNGCompression maps WORKER_PNG_COMPRESSION values to PNG compression levels
+func ParsePNGCompression(value string) (png.CompressionLevel, error) {
+	switch strings.ToLower(value) {
+	case "", "best":
+		return png.BestCompression, nil
+	case "default":
+		return png.DefaultCompression, nil
+	case "speed":
+		return png.BestSpeed, nil
+	case "none":
+		return png.NoCompression, nil
+	}
+	return png.DefaultCompression, fmt.Errorf("unknown PNG compression %q", value)
+}
+
+func processImageJob(ctx context.Context, message Message, finalAttempt bool, options WorkerOptions) error {
+	var job ImageProcessorMessage
+	err := json.Unmarshal([]byte(message.Message), &job)
+	if err != nil {
+		// Retrying cannot fix a malformed message
+		logStructured(ERROR, "Unable to parse job message", err, 0, false)
+		return nil
+	}
+	if isImageCancelled(job.ImageID) {
+		return nil
+	}
+	reportJobProgress(job, JobProcessing, 10, 0)
+	compressedSize, err := compressAndUpload(ctx, job, options)
+	if err != nil {
+		logStructured(ERROR, "Unable to process image: "+job.ImageID, err, 0, false)
+		if finalAttempt {
+			reportJobProgress(job, JobFailed, 0, 0)
+		}
+		return err
+	}
+	if isImageCancelled(job.ImageID) {
+		return nil
+	}
+	reportJobProgress(job, JobCompleted, 100, compressedSize)
+	return nil
+}
+
+func compressAndUpload(ctx context.Context, job ImageProcessorMessage, options WorkerOptions) (int64, error) {
+	original, err := DownloadFileFromS3(fmt.Sprintf("%s/%s/%s/%s", Uploads, job.UserId, job.ImageID, job.Filename))
+	if err != nil {
+		return 0, err
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	reportJobProgress(job, JobProcessing, 40, 0)
+	compressed, contentType, err := compressImage(original, job.Options, options)
+	if err != nil {
+		return 0, err
+	}
+	reportJobProgress(job, JobProcessing, 80, 0)
+	err = UploadFileToS3(&s3.PutObjectInput{
+		Bucket: aws.String(GetS3Bucket()),
+		Key: aws.String(fmt.Sprintf("%s/%s/%s/%s", Resized, job.UserId, job.ImageID, job.Filename)),
+		Body: bytes.NewReader(compressed),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(compressed)), nil
+}
+
+// compressImage re-encodes the image according to the uploader's options.
+// Re-encoding always drops metadata, so strip_metadata needs no extra handling.
+func compressImage(data []byte, processingOptions ProcessingOptions, options WorkerOptions) ([]byte, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errors.New("unable to decode image")
+	}
+	if processingOptions.MaxWidth > 0 || processingOptions.MaxHeight > 0 {
+		bounds := img.Bounds()
+		maxWidth := uint(bounds.Dx())
+		maxHeight := uint(bounds.Dy())
+		if processingOptions.MaxWidth > 0 {
+			maxWidth = uint(processingOptions.MaxWidth)
+		}
+		if processingOptions.MaxHeight > 0 {
+			maxHeight = uint(processingOptions.MaxHeight)
+		}
+		img = resize.Thumbnail(maxWidth, maxHeight, img, resize.Lanczos3)
+	}
+
+	outputFormat := processingOptions.OutputFormat
+	if outputFormat == "" {
+		outputFormat = format
+	}
+	switch outputFormat {
+	case "jpeg":
+	case "png", "gif":
+		outputFormat = "png"
+	default:
+		logStructured(WARN, "Built-in worker cannot encode "+outputFormat+", using jpeg", nil, 0, false)
+		outputFormat = "jpeg"
+	}
+
+	buf := new(bytes.Buffer)
+	if outputFormat == "png" {
+		encoder := png.Encoder{CompressionLevel: options.PNGCompression}
+		err = encoder.Encode(buf, img)
+		if err != nil {
+			return nil, "", errors.New("unable to encode image")
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+
+	quality := options.JPEGQuality
+	if processingOptions.Quality > 0 {
+		quality = processingOptions.Quality
+	}
+	for {
+		buf.Reset()
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
+		if err != nil {
+			return nil, "", errors.New("unable to encode image")
+		}
+		if processingOptions.TargetSize <= 0 || buf.Len() <= processingOptions.TargetSize || quality <= minTargetSizeQuality {
+			break
+		}
+		quality -= targetSizeQualityStep
+		if quality < minTargetSizeQuality {
+			quality = minTargetSizeQuality
+		}
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
+
+// reportJobProgress reports progress the same way the external executor does
+func reportJobProgress(job ImageProcessorMessage, status JobStatus, progress int, compressedSize int64) {
+	if eventSubscriber == nil {
+		return
+	}
+	err := eventSubscriber.Report(ImageProcessorProgressMessage{
+		ImageID: job.ImageID,
+		UserId: job.UserId,
+		Filename: job.Filename,
+		Progress: progress,
+		Status: string(status),
+		CompressedSize: compressedSize,
+	})
+	if err != nil {
+		logStructured(ERROR, "Unable to report progress for image: "+job.ImageID, err, 0, false)
+	}
+}
+
+func isImageCancelled(imageID string) bool {
+	checker, ok := publisher.(cancellationChecker)
+	return ok && checker.IsCancelled(imageID)
+}
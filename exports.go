@@ -0,0 +1,346 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportCompleted = "completed"
+	ExportFailed = "failed"
+	// The archive of a completed export was deleted after the retention period
+	ExportExpired = "expired"
+)
+
+const (
+	// Unfinished exports refresh their row this often, exports not updated for exportStaleAfter were interrupted
+	exportHeartbeatInterval = time.Minute
+	exportStaleAfter = 10 * time.Minute
+	// Maximum number of archives deleted per maintenance run
+	exportCleanupBatchSize = 100
+)
+
+// ErrExportStopped is returned when progress is reported for an export that is no longer pending or running
+var ErrExportStopped = errors.New("export is no longer running")
+
+type Export struct {
+	ID string `json:"id"`
+	UserId string `json:"user_id"`
+	Status string `json:"status"`
+	IncludeCompressed bool `json:"include_compressed"`
+	Total int `json:"total"`
+	Processed int `json:"processed"`
+	StorageKey sql.NullString `json:"-"`
+	Size sql.NullInt64 `json:"size"`
+	Error sql.NullString `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CompletedAt sql.NullTime `json:"completed_at"`
+	// Presigned link to the archive, only set on completed exports
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+type ExportBody struct {
+	IncludeCompressed bool `json:"include_compressed"`
+}
+
+type ExportOptions struct {
+	// Maximum number of exports built at the same time by this replica
+	Concurrency int
+	// Lifetime of download links
+	LinkTTL time.Duration
+	// Archives of completed exports are deleted once they are this old
+	Retention time.Duration
+	// How often interrupted exports are failed and expired archives deleted
+	MaintenanceInterval time.Duration
+}
+
+var exportOptions ExportOptions
+var exportSlots chan struct{}
+
+// InitializeExports limits concurrent exports and periodically runs the export maintenance
+func InitializeExports(options ExportOptions) {
+	exportOptions = options
+	exportSlots = make(chan struct{}, options.Concurrency)
+	maintainExports(options)
+	go func() {
+		ticker := time.NewTicker(options.MaintenanceInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			maintainExports(options)
+		}
+	}()
+}
+
+// maintainExports fails exports interrupted on any replica, so their users can start a new one, and deletes expired archives
+func maintainExports(options ExportOptions) {
+	failed, err := FailStaleExports(time.Now().Add(-exportStaleAfter))
+	if err != nil {
+		logStructured(ERROR, "Unable to fail interrupted exports", err, 0, false)
+	} else if failed > 0 {
+		logStructured(WARN, fmt.Sprintf("Failed %d interrupted exports", failed), nil, 0, false)
+	}
+	exports, err := GetExpiredExports(time.Now().Add(-options.Retention), exportCleanupBatchSize)
+	if err != nil {
+		logStructured(ERROR, "Unable to load expired exports", err, 0, false)
+		return
+	}
+	for _, export := range exports {
+		err = DeleteFileFromS3(export.StorageKey.String)
+		if err != nil {
+			logStructured(ERROR, "Unable to delete archive of export: "+export.ID, err, 0, false)
+			continue
+		}
+		err = ExpireExport(export.ID)
+		if err != nil {
+			logStructured(ERROR, "Unable to expire export: "+export.ID, err, 0, false)
+		}
+	}
+}
+
+// keepExportAlive refreshes the export's row until stop is closed, including while it waits for a slot
+func keepExportAlive(exportId string, stop <-chan struct{}) {
+	ticker := time.NewTicker(exportHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := TouchExport(exportId)
+			if err != nil {
+				logStructured(ERROR, "Unable to refresh export: "+exportId, err, 0, false)
+			}
+		}
+	}
+}
+
+func notifyExportProgress(export Export, processed int) {
+	progress := 100
+	if export.Total > 0 {
+		progress = processed * 100 / export.Total
+	}
+	NotifyProgress(ImageProcessorProgressMessage{
+		Type: "export",
+		ExportID: export.ID,
+		UserId: export.UserId,
+		Progress: progress,
+		Status: export.Status,
+	})
+}
+
+// runExport builds the archive in a temporary file, object storage needs a seekable body for uploads
+func runExport(export Export) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go keepExportAlive(export.ID, stop)
+	exportSlots <- struct{}{}
+	defer func() { <-exportSlots }()
+
+	export.Status = ExportRunning
+	storageKey := fmt.Sprintf("%s/%s/%s.zip", Exports, export.UserId, export.ID)
+	size, err := buildExport(&export, storageKey)
+	if errors.Is(err, ErrExportStopped) {
+		// Failed as interrupted in the meantime, its user may already have started another export
+		logStructured(WARN, "Export stopped: "+export.ID, err, 0, false)
+		return
+	}
+	if err != nil {
+		logStructured(ERROR, "Export failed: "+export.ID, err, 0, false)
+		export.Status = ExportFailed
+		err = FailExport(export.ID, err.Error())
+		if err != nil {
+			logStructured(ERROR, "Unable to mark export failed: "+export.ID, err, 0, false)
+		}
+		notifyExportProgress(export, export.Processed)
+		return
+	}
+	err = CompleteExport(export.ID, storageKey, size)
+	if err != nil {
+		logStructured(ERROR, "Unable to complete export: "+export.ID, err, 0, false)
+		return
+	}
+	export.Status = ExportCompleted
+	notifyExportProgress(export, export.Total)
+	logStructured(INFO, fmt.Sprintf("Export %s completed: %d images (%.2f KB)", export.ID, export.Total, float64(size)/1024), nil, 0, false)
+}
+
+func buildExport(export *Export, storageKey string) (int64, error) {
+	images, err := GetAllImages(export.UserId)
+	if err != nil {
+		return 0, err
+	}
+	export.Total = len(images)
+	err = UpdateExportProgress(export.ID, ExportRunning, export.Total, 0)
+	if err != nil {
+		return 0, err
+	}
+	notifyExportProgress(*export, 0)
+
+	file, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	manifest, err := archive.Create("manifest.json")
+	if err != nil {
+		return 0, err
+	}
+	encoder := json.NewEncoder(manifest)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(images)
+	if err != nil {
+		return 0, err
+	}
+	for i, image := range images {
+		err = addExportEntry(archive, fmt.Sprintf("originals/%s/%s", image.ImageID, image.Filename), imageStorageKey(image, "original"), image.CreatedAt)
+		if err != nil {
+			return 0, err
+		}
+		if export.IncludeCompressed && JobStatus(image.JOB_STATUS) == JobCompleted {
+			err = addExportEntry(archive, fmt.Sprintf("compressed/%s/%s", image.ImageID, image.Filename), imageStorageKey(image, "compressed"), image.COMPRESSED_AT.Time)
+			if err != nil {
+				return 0, err
+			}
+		}
+		export.Processed = i + 1
+		err = UpdateExportProgress(export.ID, ExportRunning, export.Total, export.Processed)
+		if err != nil {
+			return 0, err
+		}
+		notifyExportProgress(*export, export.Processed)
+	}
+	err = archive.Close()
+	if err != nil {
+		return 0, err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	err = UploadFileToS3(&s3.PutObjectInput{
+		Bucket: aws.String(GetS3Bucket()),
+		Key: aws.String(storageKey),
+		Body: file,
+		ContentType: aws.String("application/zip"),
+	})
+	return size, err
+}
+
+// addExportEntry streams an object from storage into the archive
+func addExportEntry(archive *zip.Writer, name string, key string, modified time.Time) error {
+	body, err := OpenFileFromS3(key)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", key, err)
+	}
+	defer body.Close()
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, body)
+	return err
+}
+
+// withDownloadURL adds a fresh presigned link to completed exports
+func withDownloadURL(export Export) Export {
+	if export.Status != ExportCompleted || !export.StorageKey.Valid {
+		return export
+	}
+	url, err := PresignDownloadURL(export.StorageKey.String, exportOptions.LinkTTL)
+	if err != nil {
+		logStructured(ERROR, "Unable to presign export: "+export.ID, err, 0, false)
+		return export
+	}
+	export.DownloadURL = url
+	return export
+}
+
+func createExport(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	var body ExportBody
+	// The body is optional
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			returnAppError(w, "Invalid request body", http.StatusBadRequest, err)
+			return
+		}
+	}
+	now := time.Now()
+	export := Export{
+		ID: uuid.New().String(),
+		UserId: userId,
+		Status: ExportPending,
+		IncludeCompressed: body.IncludeCompressed,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	created, err := InsertExport(export)
+	if err != nil {
+		returnAppError(w, "Unable to create export", http.StatusInternalServerError, err)
+		return
+	}
+	if !created {
+		returnAppError(w, "An export is already in progress", http.StatusConflict, nil)
+		return
+	}
+	go runExport(export)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(export)
+}
+
+func getExports(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	exports, err := GetExports(userId)
+	if err != nil {
+		returnAppError(w, "Unable to get exports", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exports)
+}
+
+func getExport(w http.ResponseWriter, r *http.Request) {
+	export, err := GetExport(mux.Vars(r)["export_id"], mux.Vars(r)["user_id"])
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Export not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to get export", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withDownloadURL(export))
+}
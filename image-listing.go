@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	defaultImagesPageSize = 100
+	maxImagesPageSize = 1000
+)
+
+// imageSortExpressions maps the sort keys accepted by the listing API to SQL expressions.
+// compressed_size is coalesced so images that were not compressed yet can be paged through.
+var imageSortExpressions = map[string]string{
+	"created_at": "created_at",
+	"size": "size",
+	"filename": "filename",
+	"compressed_size": "COALESCE(compressed_size, -1)",
+}
+
+// ImageListQuery holds the filters, sort order and page of an images listing
+type ImageListQuery struct {
+	Statuses []JobStatus
+	Formats []string
+	MinWidth, MaxWidth int
+	MinHeight, MaxHeight int
+	MinSize, MaxSize int
+	CreatedAfter, CreatedBefore time.Time
+	Sort string
+	Descending bool
+	Limit int
+	// Offset paging, only used without a cursor
+	Skip int
+	Cursor *imageCursor
+	// Lists the trash instead of the images in use
+	Trashed bool
+}
+
+// imageCursor is the sort value and row ID of the last image of a page
+type imageCursor struct {
+	Sort string `json:"s"`
+	Descending bool `json:"d"`
+	Value string `json:"v"`
+	ID int64 `json:"id"`
+}
+
+func encodeImageCursor(cursor imageCursor) string {
+	payload, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodeImageCursor(value string) (*imageCursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor imageCursor
+	err = json.Unmarshal(payload, &cursor)
+	if err != nil || imageSortExpressions[cursor.Sort] == "" {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// cursorSortValue returns the value of the sort key in the form stored in cursors
+func cursorSortValue(image ImageSchema, sort string) string {
+	switch sort {
+	case "size":
+		return strconv.Itoa(image.Size)
+	case "filename":
+		return image.Filename
+	case "compressed_size":
+		if !image.COMPRESSED_SIZE.Valid {
+			return "-1"
+		}
+		return strconv.FormatInt(image.COMPRESSED_SIZE.Int64, 10)
+	}
+	return image.CreatedAt.Format(time.RFC3339Nano)
+}
+
+// queryValue converts a cursor value back to the type of its column
+func (c *imageCursor) queryValue() (interface{}, error) {
+	switch c.Sort {
+	case "created_at":
+		return time.Parse(time.RFC3339Nano, c.Value)
+	case "filename":
+		return c.Value, nil
+	}
+	return strconv.ParseInt(c.Value, 10, 64)
+}
+
+// filterClause returns the WHERE conditions of the query, without the cursor, and their arguments
+func (q ImageListQuery) filterClause(userId string) (string, []interface{}) {
+	conditions := []string{"user_id = $1", "deleted_at IS NULL"}
+	if q.Trashed {
+		conditions[1] = "deleted_at IS NOT NULL"
+	}
+	args := []interface{}{userId}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if len(q.Statuses) > 0 {
+		statuses := make([]string, len(q.Statuses))
+		for i, status := range q.Statuses {
+			statuses[i] = string(status)
+		}
+		add("job_status = ANY($%d)", pq.Array(statuses))
+	}
+	if len(q.Formats) > 0 {
+		add("format = ANY($%d)", pq.Array(q.Formats))
+	}
+	if q.MinWidth > 0 {
+		add("width >= $%d", q.MinWidth)
+	}
+	if q.MaxWidth > 0 {
+		add("width <= $%d", q.MaxWidth)
+	}
+	if q.MinHeight > 0 {
+		add("height >= $%d", q.MinHeight)
+	}
+	if q.MaxHeight > 0 {
+		add("height <= $%d", q.MaxHeight)
+	}
+	if q.MinSize > 0 {
+		add("size >= $%d", q.MinSize)
+	}
+	if q.MaxSize > 0 {
+		add("size <= $%d", q.MaxSize)
+	}
+	if !q.CreatedAfter.IsZero() {
+		add("created_at >= $%d", q.CreatedAfter)
+	}
+	if !q.CreatedBefore.IsZero() {
+		add("created_at < $%d", q.CreatedBefore)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// parsePageParams reads the skip and limit offset paging parameters shared by image listings and search
+func parsePageParams(values url.Values) (int, int, error) {
+	skip, limit := 0, defaultImagesPageSize
+	var err error
+	if value := values.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxImagesPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxImagesPageSize)
+		}
+	}
+	if value := values.Get("skip"); value != "" {
+		skip, err = strconv.Atoi(value)
+		if err != nil || skip < 0 {
+			return 0, 0, errors.New("skip must be a positive integer")
+		}
+	}
+	return skip, limit, nil
+}
+
+// parseImageListQuery reads the listing query parameters.
+// The legacy skip and jobs_status parameters are still accepted.
+func parseImageListQuery(r *http.Request) (ImageListQuery, error) {
+	values := r.URL.Query()
+	query := ImageListQuery{Sort: "created_at", Descending: true, Limit: defaultImagesPageSize}
+	var err error
+
+	query.Skip, query.Limit, err = parsePageParams(values)
+	if err != nil {
+		return query, err
+	}
+	if sort := values.Get("sort"); sort != "" {
+		if imageSortExpressions[sort] == "" {
+			return query, errors.New("sort must be one of created_at, size, filename or compressed_size")
+		}
+		query.Sort = sort
+	}
+	switch values.Get("order") {
+	case "", "desc":
+	case "asc":
+		query.Descending = false
+	default:
+		return query, errors.New("order must be asc or desc")
+	}
+
+	for _, status := range splitListParam(values["status"], values.Get("jobs_status")) {
+		if !IsKnownJobStatus(JobStatus(status)) {
+			return query, errors.New("unknown status " + status)
+		}
+		query.Statuses = append(query.Statuses, JobStatus(status))
+	}
+	query.Formats = splitListParam(values["format"])
+
+	ranges := []struct {
+		name string
+		target *int
+	}{
+		{"min_width", &query.MinWidth}, {"max_width", &query.MaxWidth},
+		{"min_height", &query.MinHeight}, {"max_height", &query.MaxHeight},
+		{"min_size", &query.MinSize}, {"max_size", &query.MaxSize},
+	}
+	for _, bound := range ranges {
+		if value := values.Get(bound.name); value != "" {
+			*bound.target, err = strconv.Atoi(value)
+			if err != nil || *bound.target < 1 {
+				return query, errors.New(bound.name + " must be a positive integer")
+			}
+		}
+	}
+	if value := values.Get("created_after"); value != "" {
+		query.CreatedAfter, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, errors.New("created_after must be an RFC 3339 time")
+		}
+	}
+	if value := values.Get("created_before"); value != "" {
+		query.CreatedBefore, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, errors.New("created_before must be an RFC 3339 time")
+		}
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		if query.Skip > 0 {
+			return query, errors.New("cursor and skip cannot be combined")
+		}
+		query.Cursor, err = decodeImageCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+		if query.Cursor.Sort != query.Sort || query.Cursor.Descending != query.Descending {
+			return query, errors.New("cursor was issued for a different sort order")
+		}
+	}
+	return query, nil
+}
+
+// splitListParam accepts both repeated and comma separated values
+func splitListParam(params []string, extra ...string) []string {
+	items := []string{}
+	for _, param := range append(append([]string{}, params...), extra...) {
+		for _, item := range strings.Split(param, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
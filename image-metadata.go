@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxDisplayNameLength = 255
+	maxMetadataSize = 16 * 1024
+)
+
+var ErrImageModified = errors.New("image was modified")
+
+// ImageMetadata is the custom JSON object users can attach to an image
+type ImageMetadata map[string]interface{}
+
+// Value stores the metadata in the metadata JSONB column
+func (m ImageMetadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	return jsonStringify(m)
+}
+
+func (m *ImageMetadata) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*m = ImageMetadata{}
+		return nil
+	case []byte:
+		return json.Unmarshal(value, m)
+	case string:
+		return json.Unmarshal([]byte(value), m)
+	}
+	return fmt.Errorf("unsupported metadata type %T", src)
+}
+
+// ImageMetadataUpdate holds the fields of a PATCH request, nil fields are left unchanged
+type ImageMetadataUpdate struct {
+	DisplayName *string `json:"display_name"`
+	Description *string `json:"description"`
+	Tags *[]string `json:"tags"`
+	Metadata *ImageMetadata `json:"metadata"`
+}
+
+// imageETag identifies a version of the image, every update bumps updated_at
+func imageETag(image ImageSchema) string {
+	return fmt.Sprintf("\"%d\"", image.UpdatedAt.UnixMicro())
+}
+
+func validateDisplayName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxDisplayNameLength {
+		return "", fmt.Errorf("display_name must be between 1 and %d characters", maxDisplayNameLength)
+	}
+	if strings.ContainsAny(name, "/\\") || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return "", errors.New("display_name cannot contain slashes or control characters")
+	}
+	return name, nil
+}
+
+func validateMetadata(metadata ImageMetadata) error {
+	if metadata == nil {
+		return errors.New("metadata must be a JSON object")
+	}
+	payload, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxMetadataSize {
+		return fmt.Errorf("metadata must be at most %d bytes", maxMetadataSize)
+	}
+	return nil
+}
+
+// validate normalizes the fields present in the update
+func (u *ImageMetadataUpdate) validate() error {
+	if u.DisplayName != nil {
+		name, err := validateDisplayName(*u.DisplayName)
+		if err != nil {
+			return err
+		}
+		u.DisplayName = &name
+	}
+	if u.Description != nil {
+		description, err := validateDescription(*u.Description)
+		if err != nil {
+			return err
+		}
+		u.Description = &description
+	}
+	if u.Tags != nil {
+		tags, err := normalizeTags(*u.Tags)
+		if err != nil {
+			return err
+		}
+		u.Tags = &tags
+	}
+	if u.Metadata != nil {
+		return validateMetadata(*u.Metadata)
+	}
+	return nil
+}
+
+// updateImage changes the user editable fields of an image.
+// With an If-Match header the update is only applied to the version of the image the client has seen.
+func updateImage(w http.ResponseWriter, r *http.Request) {
+	imageID := mux.Vars(r)["image_id"]
+	userId := mux.Vars(r)["user_id"]
+	var update ImageMetadataUpdate
+	err := json.NewDecoder(r.Body).Decode(&update)
+	if err != nil {
+		returnAppError(w, "Invalid request body", http.StatusBadRequest, err)
+		return
+	}
+	err = update.validate()
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	etag := strings.TrimPrefix(strings.TrimSpace(r.Header.Get("If-Match")), "W/")
+	if etag == "*" {
+		etag = ""
+	}
+	image, err := UpdateImageMetadata(imageID, userId, etag, update)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if errors.Is(err, ErrImageModified) {
+		w.Header().Set("ETag", imageETag(image))
+		returnAppError(w, "Image was modified by another request", http.StatusPreconditionFailed, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to update image", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", imageETag(image))
+	json.NewEncoder(w).Encode(image)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type ImportOptions struct {
+	// Limit for the whole request, from connecting to reading the last byte
+	Timeout time.Duration
+	MaxSize int64
+	MaxRedirects int
+	// AllowAddress decides whether the importer may connect to an address, it is checked after DNS resolution
+	// so hostnames resolving to internal addresses are rejected too. Defaults to isPublicAddress.
+	AllowAddress func(ip net.IP) bool
+}
+
+// URLImporter downloads images from user supplied URLs
+type URLImporter struct {
+	client *http.Client
+	options ImportOptions
+}
+
+var ErrImportTooLarge = errors.New("image is too large")
+
+var importContentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png": ".png",
+	"image/gif": ".gif",
+}
+
+var unsafeFilenameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+var urlImporter *URLImporter
+
+func NewURLImporter(options ImportOptions) *URLImporter {
+	if options.AllowAddress == nil {
+		options.AllowAddress = isPublicAddress
+	}
+	client := newAddressCheckedClient(options.Timeout, options.MaxRedirects, options.AllowAddress)
+	return &URLImporter{client: client, options: options}
+}
+
+func InitializeImporter(options ImportOptions) {
+	urlImporter = NewURLImporter(options)
+}
+
+// importFilename derives a filename with an extension matching the content type from the URL path
+func importFilename(imageURL *url.URL, contentType string) string {
+	name := strings.TrimSuffix(path.Base(imageURL.Path), path.Ext(imageURL.Path))
+	name = strings.Trim(unsafeFilenameCharacters.ReplaceAllString(name, "_"), "._")
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	if name == "" {
+		name = "image"
+	}
+	return name + importContentTypes[contentType]
+}
+
+// Fetch downloads the image into a temporary file, the caller closes and removes it.
+// The declared and the sniffed content type both have to be a supported image type.
+func (i *URLImporter) Fetch(ctx context.Context, imageURL *url.URL) (*os.File, string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	request.Header.Set("Accept", "image/jpeg, image/png, image/gif")
+	response, err := i.client.Do(request)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("remote server answered %d", response.StatusCode)
+	}
+	if response.ContentLength > i.options.MaxSize {
+		return nil, "", ErrImportTooLarge
+	}
+	contentType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil || importContentTypes[contentType] == "" {
+		return nil, "", fmt.Errorf("unsupported content type %q", response.Header.Get("Content-Type"))
+	}
+
+	file, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		return nil, "", err
+	}
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	// One byte more than allowed tells a body that is too large from one of exactly MaxSize
+	written, err := io.Copy(file, io.LimitReader(response.Body, i.options.MaxSize+1))
+	if err != nil {
+		cleanup()
+		return nil, "", err
+	}
+	if written > i.options.MaxSize {
+		cleanup()
+		return nil, "", ErrImportTooLarge
+	}
+	head := make([]byte, 512)
+	n, _ := file.ReadAt(head, 0)
+	if http.DetectContentType(head[:n]) != contentType {
+		cleanup()
+		return nil, "", fmt.Errorf("content does not match content type %q", contentType)
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		cleanup()
+		return nil, "", err
+	}
+	return file, importFilename(response.Request.URL, contentType), nil
+}
+
+// importImage creates an image from a remote URL. It takes the same form values as uploads, with url instead of the image file.
+func importImage(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	imageURL, err := url.Parse(strings.TrimSpace(r.FormValue("url")))
+	if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") || imageURL.Host == "" {
+		returnAppError(w, "url must be an absolute http or https URL", http.StatusBadRequest, nil)
+		return
+	}
+	if imageURL.User != nil {
+		returnAppError(w, "url must not contain credentials", http.StatusBadRequest, nil)
+		return
+	}
+	file, filename, err := urlImporter.Fetch(r.Context(), imageURL)
+	if errors.Is(err, ErrImportTooLarge) {
+		returnAppError(w, fmt.Sprintf("Image is larger than %d bytes", urlImporter.options.MaxSize), http.StatusRequestEntityTooLarge, nil)
+		return
+	}
+	if err != nil {
+		// Details of the failure could be used to probe the network, only the log has them
+		logStructured(WARN, "Unable to import image from "+imageURL.Redacted(), err, http.StatusBadGateway, false)
+		returnAppError(w, "Unable to fetch image from url", http.StatusBadGateway, nil)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		returnAppError(w, "Unable to read imported image", http.StatusInternalServerError, err)
+		return
+	}
+	ingestImage(w, r, userId, File{
+		File: file,
+		Header: &multipart.FileHeader{Filename: filename, Size: info.Size()},
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encodeTestImage(t *testing.T, format string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	var err error
+	if format == "png" {
+		err = png.Encode(&buffer, img)
+	} else {
+		err = jpeg.Encode(&buffer, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// newTestImporter lets the importer reach httptest servers, which listen on loopback
+func newTestImporter(maxSize int64, maxRedirects int) *URLImporter {
+	return NewURLImporter(ImportOptions{
+		Timeout: 5 * time.Second,
+		MaxSize: maxSize,
+		MaxRedirects: maxRedirects,
+		AllowAddress: func(ip net.IP) bool { return ip.IsLoopback() },
+	})
+}
+
+func fetchTestURL(t *testing.T, importer *URLImporter, rawURL string) ([]byte, string, error) {
+	t.Helper()
+	imageURL, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, filename, err := importer.Fetch(context.Background(), imageURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content, filename, nil
+}
+
+func TestURLImporterFetch(t *testing.T) {
+	pngImage := encodeTestImage(t, "png")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngImage)
+	}))
+	defer server.Close()
+
+	content, filename, err := fetchTestURL(t, newTestImporter(1<<20, 3), server.URL+"/photos/my%20cat!.PNG")
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if !bytes.Equal(content, pngImage) {
+		t.Errorf("got %d bytes, want the %d bytes served", len(content), len(pngImage))
+	}
+	if filename != "my_cat.png" {
+		t.Errorf("filename = %q, want %q", filename, "my_cat.png")
+	}
+}
+
+func TestURLImporterRedirects(t *testing.T) {
+	pngImage := encodeTestImage(t, "png")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// /hop/{n} redirects n more times before serving the image
+		hops, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if hops > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/hop/%d", hops-1), http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngImage)
+	}))
+	defer server.Close()
+	importer := newTestImporter(1<<20, 2)
+
+	_, _, err := fetchTestURL(t, importer, server.URL+"/hop/2")
+	if err != nil {
+		t.Errorf("fetch within the redirect limit failed: %v", err)
+	}
+	_, _, err = fetchTestURL(t, importer, server.URL+"/hop/3")
+	if err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("fetch beyond the redirect limit: got %v, want a redirect error", err)
+	}
+}
+
+func TestURLImporterTooLarge(t *testing.T) {
+	pngImage := encodeTestImage(t, "png")
+	body := append(pngImage, make([]byte, 4096)...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		if r.URL.Path == "/chunked" {
+			// Flushing before the body is complete makes the response chunked, without Content-Length
+			w.Write(body[:100])
+			w.(http.Flusher).Flush()
+			w.Write(body[100:])
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	defer server.Close()
+	importer := newTestImporter(int64(len(body)-1), 3)
+
+	for _, path := range []string{"/content-length", "/chunked"} {
+		_, _, err := fetchTestURL(t, importer, server.URL+path)
+		if !errors.Is(err, ErrImportTooLarge) {
+			t.Errorf("%s: got %v, want ErrImportTooLarge", path, err)
+		}
+	}
+	_, _, err := fetchTestURL(t, newTestImporter(int64(len(body)), 3), server.URL+"/chunked")
+	if err != nil {
+		t.Errorf("body of exactly MaxSize: got %v, want success", err)
+	}
+}
+
+func TestURLImporterContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		contentType string
+		body []byte
+	}{
+		{"declared type is not an image", "text/html", encodeTestImage(t, "png")},
+		{"content is not an image", "image/png", []byte("<html><body>not an image</body></html>")},
+		{"content is another image type", "image/png", encodeTestImage(t, "jpeg")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				w.Write(test.body)
+			}))
+			defer server.Close()
+			_, _, err := fetchTestURL(t, newTestImporter(1<<20, 3), server.URL+"/image.png")
+			if err == nil {
+				t.Error("fetch succeeded, want a content type error")
+			}
+		})
+	}
+}
+
+func TestURLImporterDefaultPolicyRejectsLoopback(t *testing.T) {
+	served := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+	defer server.Close()
+	importer := NewURLImporter(ImportOptions{Timeout: 5 * time.Second, MaxSize: 1 << 20, MaxRedirects: 3})
+
+	_, _, err := fetchTestURL(t, importer, server.URL+"/image.png")
+	if !errors.Is(err, ErrAddressNotAllowed) {
+		t.Errorf("got %v, want ErrAddressNotAllowed", err)
+	}
+	if served {
+		t.Error("the request reached the server")
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1": false,
+		"::1": false,
+		"10.1.2.3": false,
+		"192.168.0.10": false,
+		"169.254.169.254": false,
+		"100.64.0.1": false,
+		"0.0.0.0": false,
+		"fe80::1": false,
+		"93.184.216.34": true,
+		"2606:2800:220:1::1": true,
+	}
+	for address, want := range tests {
+		if got := isPublicAddress(net.ParseIP(address)); got != want {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+type JobStatus string
+
+const (
+	JobInQueue JobStatus = "in-queue"
+	JobProcessing JobStatus = "processing"
+	JobCompleted JobStatus = "completed"
+	JobFailed JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+var ErrIllegalJobTransition = errors.New("illegal job status transition")
+
+// ErrJobChanged is returned by conditional transitions when the image was updated concurrently
+var ErrJobChanged = errors.New("job changed concurrently")
+
+// jobTransitions lists the statuses each status may move to.
+// Repeating the current status is allowed for in-flight states so progress updates are accepted.
+// Failed is final until the image is reprocessed, executors only report it for the last attempt.
+var jobTransitions = map[JobStatus][]JobStatus{
+	JobInQueue: {JobInQueue, JobProcessing, JobCompleted, JobFailed, JobCancelled},
+	JobProcessing: {JobProcessing, JobCompleted, JobFailed, JobCancelled},
+	JobFailed: {JobInQueue},
+	JobCancelled: {JobInQueue},
+	JobCompleted: {},
+}
+
+func IsKnownJobStatus(status JobStatus) bool {
+	_, ok := jobTransitions[status]
+	return ok
+}
+
+// ValidateJobTransition returns ErrIllegalJobTransition when the job cannot move from one status to the other
+func ValidateJobTransition(from JobStatus, to JobStatus) error {
+	if !IsKnownJobStatus(to) {
+		return fmt.Errorf("%w: unknown status %q", ErrIllegalJobTransition, to)
+	}
+	for _, allowed := range jobTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrIllegalJobTransition, from, to)
+}
+
+// ValidateRequeue returns ErrIllegalJobTransition unless reprocessing may send the image back in queue:
+// failed and cancelled images, and completed ones when recompressing. Queued images keep their job and its place.
+func ValidateRequeue(from JobStatus, recompress bool) error {
+	if from == JobFailed || from == JobCancelled || (from == JobCompleted && recompress) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s cannot be requeued", ErrIllegalJobTransition, from)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type DeadLetterEntry struct {
+	Image ImageSchema `json:"image"`
+	AttemptsMade int `json:"attempts_made"`
+	FailedReason string `json:"failed_reason"`
+}
+
+type DeadLetterResponse struct {
+	Images []DeadLetterEntry `json:"images"`
+	TotalCount int `json:"count"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ErrJobNotRemovable is returned when the image's previous job cannot be removed from the queue, e.g. while a worker holds it
+var ErrJobNotRemovable = errors.New("previous job cannot be removed")
+
+// requeueImage moves a failed or cancelled image back in queue and enqueues a new job with its stored options.
+// With recompress completed images are requeued too. Queued and processing images are rejected with ErrIllegalJobTransition.
+func requeueImage(image ImageSchema, recompress bool) error {
+	err := ValidateRequeue(JobStatus(image.JOB_STATUS), recompress)
+	if err != nil {
+		return err
+	}
+	// The previous job keeps the image ID as its job ID, remove it so the new job is not deduplicated against it.
+	// It goes first so a job that cannot be removed leaves the image untouched.
+	err = RemoveJob(image.ImageID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrJobNotRemovable, err)
+	}
+	// A cancellation left by an earlier run would make the executor skip the new job
+	err = ClearCancellation(image.ImageID)
+	if err != nil {
+		return fmt.Errorf("unable to clear previous cancellation: %w", err)
+	}
+	err = TransitionJobStatus(JobTransition{ImageID: image.ImageID, UserId: image.UserId, Requeue: true, Recompress: recompress})
+	if err != nil {
+		return err
+	}
+	return enqueueImageJob(image.ImageID, image.UserId, imageObjectName(image.Filename, image.Version), image.ProcessingOptions, image.ScheduledAt)
+}
+
+// reprocessImage sends a failed or cancelled image back in queue and publishes it again
+func reprocessImage(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	imageID := mux.Vars(r)["image_id"]
+	if userId == "" || imageID == "" {
+		returnAppError(w, "User ID or image ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	imageResponse, err := GetImageById(imageID, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to get image", http.StatusInternalServerError, err)
+		return
+	}
+	err = requeueImage(imageResponse.Image, false)
+	if errors.Is(err, ErrIllegalJobTransition) {
+		returnAppError(w, "Image cannot be reprocessed in status "+imageResponse.Image.JOB_STATUS, http.StatusConflict, nil)
+		return
+	}
+	if errors.Is(err, ErrJobNotRemovable) {
+		returnAppError(w, "Previous job of the image is still held by a worker, try again later", http.StatusConflict, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to reprocess image", http.StatusInternalServerError, err)
+		return
+	}
+	imageResponse.Image.JOB_STATUS = string(JobInQueue)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(imageResponse.Image)
+}
+
+// stopImageJob moves the image to cancelled, removes its queued job and signals a running one to the executor
+func stopImageJob(image ImageSchema) error {
+	// Moving the row first makes later progress from the executor illegal transitions, so it cannot be revived
+	err := TransitionJobStatus(JobTransition{ImageID: image.ImageID, UserId: image.UserId, Status: JobCancelled})
+	if err != nil {
+		return err
+	}
+	started, err := CancelJob(image.ImageID)
+	if err != nil {
+		logStructured(ERROR, "Unable to remove job for image: "+image.ImageID, err, 0, false)
+	}
+	if started || err != nil {
+		err = PublishCancellation(image.ImageID, image.UserId)
+		if err != nil {
+			logStructured(ERROR, "Unable to publish cancellation for image: "+image.ImageID, err, 0, false)
+		}
+	}
+	NotifyProgress(ImageProcessorProgressMessage{
+		ImageID: image.ImageID,
+		UserId: image.UserId,
+		Filename: image.Filename,
+		Status: string(JobCancelled),
+	})
+	return nil
+}
+
+// cancelImage stops processing of an image: queued jobs are removed, running ones are signalled to the executor
+func cancelImage(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	imageID := mux.Vars(r)["image_id"]
+	if userId == "" || imageID == "" {
+		returnAppError(w, "User ID or image ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	imageResponse, err := GetImageById(imageID, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to get image", http.StatusInternalServerError, err)
+		return
+	}
+	err = stopImageJob(imageResponse.Image)
+	if errors.Is(err, ErrIllegalJobTransition) {
+		returnAppError(w, "Image cannot be cancelled in status "+imageResponse.Image.JOB_STATUS, http.StatusConflict, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to cancel image", http.StatusInternalServerError, err)
+		return
+	}
+	imageResponse.Image.JOB_STATUS = string(JobCancelled)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imageResponse.Image)
+}
+
+// getDeadLetterImages lists images whose jobs failed after exhausting their retries, with the queue's failure details
+func getDeadLetterImages(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	query, err := parseImageListQuery(r)
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	query.Statuses = []JobStatus{JobFailed}
+	imagesResponse, err := GetImagesByUserId(userId, query)
+	if err != nil {
+		returnAppError(w, "Unable to get images", http.StatusInternalServerError, err)
+		return
+	}
+	entries := []DeadLetterEntry{}
+	for _, image := range imagesResponse.Images {
+		entry := DeadLetterEntry{Image: image}
+		job, err := GetJob(image.ImageID)
+		if err != nil {
+			logStructured(WARN, "Unable to load job for image: "+image.ImageID, err, 0, false)
+		} else {
+			entry.AttemptsMade = job.AttemptsMade
+			entry.FailedReason = job.FailedReason
+		}
+		entries = append(entries, entry)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DeadLetterResponse{Images: entries, TotalCount: imagesResponse.TotalCount, NextCursor: imagesResponse.NextCursor})
+}
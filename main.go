@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,7 +18,6 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -57,6 +57,7 @@ type ImageProcessorMessage struct {
 	ImageID string `json:"image_id"`
 	UserId string `json:"user_id"`
 	Filename string `json:"filename"`
+	Options ProcessingOptions `json:"options"`
 }
 
 type ImageProcessorFolder string
@@ -65,6 +66,7 @@ const (
 	Uploads ImageProcessorFolder = "uploads"
 	Resized ImageProcessorFolder = "resized"
 	Thumbnail ImageProcessorFolder = "thumbnail"
+	Exports ImageProcessorFolder = "exports"
 )
 
 var upgrader = websocket.Upgrader{
@@ -72,7 +74,6 @@ var upgrader = websocket.Upgrader{
 		return true
 	},
 }
-var addWSClientMutex sync.Mutex = sync.Mutex{}
 
 // LogLevel represents different log levels
 type LogLevel string
@@ -161,6 +162,15 @@ func jsonStringify(data interface{}) (string, error) {
 	return string(jsonBytes), nil
 }
 
+// getEnvInt reads an integer environment variable, falling back to the default when unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 func initStorage() error{
 	host := os.Getenv("STORAGE_END_POINT")
 	region := os.Getenv("STORAGE_REGION")
@@ -182,6 +192,48 @@ func initStorage() error{
 	return nil
 }
 
+// initBroker sets up the publisher and event subscriber selected by BROKER, "redis" (default) or "memory"
+func initBroker(publisherOptions Options) error {
+	if os.Getenv("BROKER") == "memory" {
+		broker := NewMemoryBroker()
+		InitializePublisher(broker, publisherOptions)
+		InitializeEventSubscriber(broker)
+		return nil
+	}
+	redisUrl := os.Getenv("REDIS_URL")
+	if redisUrl == "" {
+		return errors.New("no REDIS_URL provided")
+	}
+	redisPublisher, err := NewRedisPublisher(redisUrl, publisherOptions)
+	if err != nil {
+		return err
+	}
+	InitializePublisher(redisPublisher, publisherOptions)
+
+	progressStream := os.Getenv("PROGRESS_STREAM")
+	if progressStream == "" {
+		progressStream = "image-processor-progress"
+	}
+	progressGroup := os.Getenv("PROGRESS_CONSUMER_GROUP")
+	if progressGroup == "" {
+		progressGroup = "image-processor-api"
+	}
+	consumerName, err := os.Hostname()
+	if err != nil {
+		consumerName = uuid.New().String()
+	}
+	redisEventSubscriber, err := NewRedisEventSubscriber(redisUrl, EventSubscriberOptions{
+		Stream: progressStream,
+		Group: progressGroup,
+		Consumer: consumerName,
+	})
+	if err != nil {
+		return err
+	}
+	InitializeEventSubscriber(redisEventSubscriber)
+	return nil
+}
+
 func returnAppError(w http.ResponseWriter, message string, statusCode int, err error) {
 	appError := AppError{Message: message}
 	w.Header().Set("Content-Type", "application/json")
@@ -265,6 +317,62 @@ func resizeImage(file File) ( *bytes.Buffer, error) {
 	return buf, nil
 }
 
+// enqueueImageJob publishes the processing job of an image to the queue of the user's tier, the image ID is used as the job ID.
+// filename is the object name of the version to process, see imageObjectName.
+func enqueueImageJob(imageID string, userId string, filename string, options ProcessingOptions, scheduledAt sql.NullTime) error {
+	queueName, jobOptions, err := RouteJob(userId)
+	if err != nil {
+		return err
+	}
+	imageProcessorMessage := ImageProcessorMessage{
+		ImageID: imageID,
+		UserId: userId,
+		Filename: filename,
+		Options: options,
+	}
+	messageJSON, err := jsonStringify(imageProcessorMessage)
+	if err != nil {
+		return err
+	}
+	return PublishMessage(Message{
+		Pattern: "image-processor",
+		Message: messageJSON,
+		MessageId: imageID,
+		QueueName: queueName,
+		JobOptions: &jobOptions,
+		Delay: jobDelay(scheduledAt),
+	})
+}
+
+// storeImageFiles uploads the original and its thumbnail, objectName is the path of both below the image's folders
+func storeImageFiles(file File, userId string, imageID string, objectName string) error {
+	file.File.Seek(0, 0)
+	s3Object := s3.PutObjectInput{
+		Bucket: aws.String(GetS3Bucket()),
+		Key: aws.String(fmt.Sprintf("%s/%s/%s/%s", Uploads, userId, imageID, objectName)),
+		Body: file.File,
+	}
+	err := UploadFileToS3(&s3Object)
+	if err != nil {
+		fmt.Println("Error uploading file to storage:", err)
+		return err
+	}
+
+	// Resize image
+	file.File.Seek(0, 0)
+	buf, err := resizeImage(file)
+	if err != nil {
+		return err
+	}
+	s3Object.Body = buf
+	s3Object.Key = aws.String(fmt.Sprintf("%s/%s/%s/%s", Thumbnail, userId, imageID, objectName))
+	err = UploadFileToS3(&s3Object)
+	if err != nil {
+		fmt.Println("Error uploading file to storage:", err)
+	}
+	return err
+}
+
 // uploadHandler handles image file uploads and prints image information
 func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	userId := mux.Vars(r)["user_id"]
@@ -279,43 +387,38 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer file.File.Close()
+	ingestImage(w, r, userId, file)
+}
 
-	imageInfo, err := parseImageFromFile(file)
-	imageInfo.userId = userId
-
+// ingestImage stores a new image received by uploadHandler or importImage.
+// Processing options, schedule and metadata are read from the request's form values.
+func ingestImage(w http.ResponseWriter, r *http.Request, userId string, file File) {
+	processingOptions, err := parseProcessingOptions(r)
 	if err != nil {
-		returnAppError(w, err.Error(), http.StatusBadRequest, err)
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
 		return
 	}
-	imageID := uuid.New().String();
-	// Try to insert into database if connection is available
-	filePath := fmt.Sprintf("%s/%s/%s/%s", Uploads, userId, imageID,imageInfo.Filename) 
-	file.File.Seek(0, 0)
-	s3Object := s3.PutObjectInput{
-		Bucket: aws.String(GetS3Bucket()),
-		Key: aws.String(filePath),
-		Body: file.File,
+	scheduledAt, err := parseSchedule(r)
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
 	}
-	err = UploadFileToS3(&s3Object)
+	description, tags, err := parseImageMetadata(r)
 	if err != nil {
-		fmt.Println("Error uploading file to storage:", err)
-		returnAppError(w, "Unable to save file to storage", http.StatusInternalServerError, err)
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
 		return
 	}
 
-	// Resize image
-	file.File.Seek(0, 0)
-	buf, err := resizeImage(file)
+	imageInfo, err := parseImageFromFile(file)
+	imageInfo.userId = userId
+
 	if err != nil {
-		returnAppError(w, "Unable to resize image", http.StatusInternalServerError, err)
+		returnAppError(w, err.Error(), http.StatusBadRequest, err)
 		return
 	}
-	s3Object.Body = buf
-	filePath = fmt.Sprintf("%s/%s/%s/%s", Thumbnail, userId, imageID, imageInfo.Filename)
-	s3Object.Key = aws.String(filePath)
-	err = UploadFileToS3(&s3Object)
+	imageID := uuid.New().String();
+	err = storeImageFiles(file, userId, imageID, imageInfo.Filename)
 	if err != nil {
-		fmt.Println("Error uploading file to storage:", err)
 		returnAppError(w, "Unable to save file to storage", http.StatusInternalServerError, err)
 		return
 	}
@@ -330,7 +433,14 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		ImageID: imageID,
-		JOB_STATUS: "in-queue",
+		JOB_STATUS: string(JobInQueue),
+		ProcessingOptions: processingOptions,
+		ScheduledAt: scheduledAt,
+		Description: description,
+		Tags: tags,
+		DisplayName: imageInfo.Filename,
+		Metadata: ImageMetadata{},
+		Version: 1,
 	}
 	err = InsertImage(imageObject)
 	if err != nil {
@@ -341,28 +451,12 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	// Log successful upload
 	logStructured(INFO, fmt.Sprintf("Image uploaded successfully: %s (%.2f KB)", imageInfo.Filename, float64(imageInfo.Size)/1024), nil, 200, false)
 	
-	imageProcessorMessage := ImageProcessorMessage{
-		ImageID: imageID,
-		UserId: imageInfo.userId,
-		Filename: imageInfo.Filename,
-	}
-	
-	// JSON stringify the message using helper function
-	messageJSON, err := jsonStringify(imageProcessorMessage)
+	err = enqueueImageJob(imageID, imageInfo.userId, imageInfo.Filename, processingOptions, scheduledAt)
 	if err != nil {
-		logStructured(ERROR, "Failed to marshal message to JSON", err, 0, true)
 		// Continue with upload success even if message publishing fails
+		logStructured(ERROR, "Failed to publish message", err, 0, false)
 	} else {
-		err = PublishMessage(Message{
-			Pattern: "image-processor",
-			Message: messageJSON,
-			MessageId: imageID,
-		})
-		if err != nil {
-			logStructured(ERROR, "Failed to publish message", err, 0, false)
-		} else {
-			logStructured(INFO, fmt.Sprintf("Message published successfully for image: %s", imageID), nil, 0, false)
-		}
+		logStructured(INFO, fmt.Sprintf("Message published successfully for image: %s", imageID), nil, 0, false)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(imageInfo)
@@ -370,20 +464,16 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 
 func getImagesByUserId(w http.ResponseWriter, r *http.Request) {
 	userId := mux.Vars(r)["user_id"]
-	skip, err := strconv.Atoi(r.URL.Query().Get("skip"))
-	if err != nil {
-		skip = 0
-	}
-	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
-	if err != nil {
-		limit = 100
-	}
-	jobsStatus := r.URL.Query().Get("jobs_status")
 	if userId == "" {
 		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
 		return
 	}
-	imagesResponse, err := GetImagesByUserId(userId, skip, limit, jobsStatus)
+	query, err := parseImageListQuery(r)
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	imagesResponse, err := GetImagesByUserId(userId, query)
 	if err != nil {
 		returnAppError(w, "Unable to get images", http.StatusInternalServerError, err)
 		return
@@ -398,25 +488,25 @@ func updateImageJobStatus(w http.ResponseWriter, r *http.Request) {
 		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
 		return
 	}
+	var replay func() ([]sequencedMessage, error) = nil
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		since, err := parseSequence(sinceParam)
+		if err != nil {
+			returnAppError(w, "Invalid since sequence", http.StatusBadRequest, err)
+			return
+		}
+		replay = func() ([]sequencedMessage, error) {
+			return loadProgressReplay(userId, since)
+		}
+	}
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		returnAppError(w, "Unable to upgrade to websocket", http.StatusInternalServerError, err)
 		return
 	}
-	defer ws.Close()
-	addWSClientMutex.Lock()
-	clients[userId] = ws
-	addWSClientMutex.Unlock()
-
-	for {
-		_, _, err := ws.ReadMessage()
-		if err != nil {
-			addWSClientMutex.Lock()
-			delete(clients, userId)
-			addWSClientMutex.Unlock()
-			return
-		}
-	}
+	// The hub's send goroutine owns closing the connection
+	client := wsHub.Register(userId, ws, replay)
+	client.readPump(wsHub)
 }
 
 func getImageById(w http.ResponseWriter, r *http.Request) {
@@ -436,6 +526,7 @@ func getImageById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", imageETag(image.Image))
 	json.NewEncoder(w).Encode(image)
 }
 
@@ -458,7 +549,64 @@ func main() {
 	router.HandleFunc("/users/{user_id}/images", uploadHandler).Methods("POST")
 	router.HandleFunc("/users/{user_id}/images", getImagesByUserId).Methods("GET")
 	router.HandleFunc("/ws/users/{user_id}/images", updateImageJobStatus).Methods("GET")
+	// Must be registered before /images/{image_id} so "events" is not treated as an image ID
+	router.HandleFunc("/users/{user_id}/images/events", streamImageEvents).Methods("GET")
+	router.HandleFunc("/users/{user_id}/images/dead-letter", getDeadLetterImages).Methods("GET")
+	router.HandleFunc("/users/{user_id}/images/search", searchImages).Methods("GET")
+	router.HandleFunc("/users/{user_id}/images/import", importImage).Methods("POST")
 	router.HandleFunc("/users/{user_id}/images/{image_id}", getImageById).Methods("GET")
+	router.HandleFunc("/users/{user_id}/images/{image_id}", updateImage).Methods("PATCH")
+	router.HandleFunc("/users/{user_id}/images/{image_id}", replaceImage).Methods("PUT")
+	router.HandleFunc("/users/{user_id}/images/{image_id}", deleteImage).Methods("DELETE")
+	router.HandleFunc("/users/{user_id}/trash", getTrash).Methods("GET")
+	router.HandleFunc("/users/{user_id}/shares", createShareLink).Methods("POST")
+	router.HandleFunc("/users/{user_id}/shares", getShareLinks).Methods("GET")
+	router.HandleFunc("/users/{user_id}/shares/{token}", deleteShareLink).Methods("DELETE")
+	router.HandleFunc("/s/{token}", serveShareLink).Methods("GET")
+	router.HandleFunc("/users/{user_id}/images/{image_id}/signed-url", getSignedImageURL).Methods("GET")
+	router.HandleFunc("/img/{image_id}/{variant:original|compressed|thumbnail}", serveSignedImage).Methods("GET")
+	router.HandleFunc("/users/{user_id}/trash/{image_id}/restore", restoreImage).Methods("POST")
+	router.HandleFunc("/users/{user_id}/trash/{image_id}", purgeTrashedImage).Methods("DELETE")
+	router.HandleFunc("/users/{user_id}/images/{image_id}/versions", getImageVersions).Methods("GET")
+	router.HandleFunc("/users/{user_id}/images/{image_id}/versions/{version}/restore", restoreImageVersion).Methods("POST")
+	router.HandleFunc("/users/{user_id}/images/{image_id}/reprocess", reprocessImage).Methods("POST")
+	router.HandleFunc("/users/{user_id}/images/{image_id}/cancel", cancelImage).Methods("POST")
+	router.HandleFunc("/users/{user_id}/images/{image_id}/schedule", rescheduleImage).Methods("PUT")
+	router.HandleFunc("/users/{user_id}/images/{image_id}/tags", setImageTags).Methods("PUT")
+	router.HandleFunc("/users/{user_id}/images/{image_id}/tags", addImageTags).Methods("POST")
+	router.HandleFunc("/users/{user_id}/images/{image_id}/tags/{tag}", removeImageTag).Methods("DELETE")
+	router.HandleFunc("/users/{user_id}/images/{image_id}/description", setImageDescription).Methods("PUT")
+	router.HandleFunc("/users/{user_id}/tags", getUserTags).Methods("GET")
+	router.HandleFunc("/users/{user_id}/albums", createAlbum).Methods("POST")
+	router.HandleFunc("/users/{user_id}/albums", getAlbums).Methods("GET")
+	router.HandleFunc("/users/{user_id}/albums/{album_id}", getAlbum).Methods("GET")
+	router.HandleFunc("/users/{user_id}/albums/{album_id}", updateAlbum).Methods("PATCH")
+	router.HandleFunc("/users/{user_id}/albums/{album_id}", deleteAlbum).Methods("DELETE")
+	router.HandleFunc("/users/{user_id}/albums/{album_id}/images", addAlbumImages).Methods("POST")
+	router.HandleFunc("/users/{user_id}/albums/{album_id}/images/{image_id}", removeAlbumImage).Methods("DELETE")
+	router.HandleFunc("/users/{user_id}/albums/{album_id}/order", reorderAlbumImages).Methods("PUT")
+	router.HandleFunc("/users/{user_id}/albums/{album_id}/download", downloadAlbum).Methods("GET")
+	router.HandleFunc("/users/{user_id}/albums/{album_id}/reprocess", reprocessAlbum).Methods("POST")
+	router.HandleFunc("/users/{user_id}/exports", createExport).Methods("POST")
+	router.HandleFunc("/users/{user_id}/exports", getExports).Methods("GET")
+	router.HandleFunc("/users/{user_id}/exports/{export_id}", getExport).Methods("GET")
+	router.HandleFunc("/users/{user_id}/webhooks", createWebhook).Methods("POST")
+	router.HandleFunc("/users/{user_id}/webhooks", getWebhooks).Methods("GET")
+	router.HandleFunc("/users/{user_id}/webhooks/{webhook_id}", deleteWebhook).Methods("DELETE")
+	router.HandleFunc("/users/{user_id}/webhooks/{webhook_id}/deliveries", getWebhookDeliveries).Methods("GET")
+	router.HandleFunc("/users/{user_id}/webhooks/{webhook_id}/deliveries/{delivery_id}/redeliver", redeliverWebhook).Methods("POST")
+
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(requireAdminToken)
+	admin.HandleFunc("/users/{user_id}/tier", getUserTier).Methods("GET")
+	admin.HandleFunc("/users/{user_id}/tier", setUserTier).Methods("PUT")
+	admin.HandleFunc("/queues", listQueues).Methods("GET")
+	admin.HandleFunc("/queues/{queue_name}/jobs", listQueueJobs).Methods("GET")
+	admin.HandleFunc("/queues/{queue_name}/pause", pauseQueue).Methods("POST")
+	admin.HandleFunc("/queues/{queue_name}/resume", resumeQueue).Methods("POST")
+	admin.HandleFunc("/queues/{queue_name}/drain", drainQueue).Methods("POST")
+	admin.HandleFunc("/queues/{queue_name}/promote", promoteQueueJobs).Methods("POST")
+	admin.HandleFunc("/reconciler", getReconcilerStats).Methods("GET")
 
 	if err := godotenv.Load(".env"); err != nil {
 		fmt.Println("No .env file found, using system environment variables.")
@@ -486,26 +634,92 @@ func main() {
 		fmt.Println("Error initializing storage:", err)
 		return
 	}
-	redisUrl := os.Getenv("REDIS_URL")
 	queueName := os.Getenv("QUEUE_NAME")
-	if redisUrl == "" {
-		fmt.Println("No REDIS_URL provided.")
+	queueRoutes, err := ParseQueueRoutes(os.Getenv("QUEUE_ROUTES"), queueName)
+	if err != nil {
+		fmt.Println("Error parsing queue routes:", err)
 		return
 	}
 	publisherOptions := Options{
 		QueueName: queueName,
-	}
-	err = InitializePublisher(redisUrl, publisherOptions)
+		Routes: queueRoutes,
+		Fairness: FairnessOptions{
+			Step: getEnvInt("FAIRNESS_STEP", 10),
+			MaxPenalty: getEnvInt("FAIRNESS_MAX_PENALTY", 1000),
+		},
+		DefaultJobOptions: JobOptions{
+			Attempts: getEnvInt("JOB_ATTEMPTS", 3),
+			BackoffDelay: getEnvInt("JOB_BACKOFF_DELAY_MS", 5000),
+			Timeout: getEnvInt("JOB_TIMEOUT_MS", 0),
+			Priority: getEnvInt("JOB_PRIORITY", 0),
+		},
+	}
+	err = initBroker(publisherOptions)
 	if err != nil {
-		fmt.Println("Error initializing publisher:", err)
+		fmt.Println("Error initializing broker:", err)
 		return
 	}
-	err = InitializeEventSubscriber(redisUrl)
+	StartProgressEvents()
+	if os.Getenv("BUILTIN_WORKER") == "true" {
+		pngCompression, err := ParsePNGCompression(os.Getenv("WORKER_PNG_COMPRESSION"))
+		if err != nil {
+			fmt.Println("Error parsing worker options:", err)
+			return
+		}
+		err = StartBuiltinWorker(WorkerOptions{
+			Concurrency: getEnvInt("WORKER_CONCURRENCY", 2),
+			JPEGQuality: getEnvInt("WORKER_JPEG_QUALITY", 75),
+			PNGCompression: pngCompression,
+		})
+		if err != nil {
+			fmt.Println("Error starting built-in worker:", err)
+			return
+		}
+	}
+	if os.Getenv("RECONCILER_ENABLED") != "false" {
+		StartReconciler(ReconcilerOptions{
+			Interval: time.Duration(getEnvInt("RECONCILER_INTERVAL_SECONDS", 60)) * time.Second,
+			StuckAfter: time.Duration(getEnvInt("RECONCILER_STUCK_AFTER_SECONDS", 900)) * time.Second,
+			BatchSize: getEnvInt("RECONCILER_BATCH_SIZE", 100),
+		})
+	}
+	if os.Getenv("TRASH_PURGER_ENABLED") != "false" {
+		StartTrashPurger(TrashPurgerOptions{
+			Interval: time.Duration(getEnvInt("TRASH_PURGE_INTERVAL_SECONDS", 3600)) * time.Second,
+			Retention: time.Duration(getEnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+			BatchSize: getEnvInt("TRASH_PURGE_BATCH_SIZE", 100),
+		})
+	}
+	signingSecrets, err := ParseURLSigningSecrets(os.Getenv("SIGNED_URL_SECRETS"))
 	if err != nil {
-		fmt.Println("Error initializing event subscriber:", err)
+		fmt.Println("Error parsing signed URL secrets:", err)
 		return
 	}
-	go SubscribeToEvent("image-processor-progress")
+	InitializeURLSigning(URLSigningOptions{
+		Secrets: signingSecrets,
+		BaseURL: strings.TrimSuffix(os.Getenv("SIGNED_URL_BASE"), "/"),
+		DefaultTTL: time.Duration(getEnvInt("SIGNED_URL_TTL_SECONDS", 3600)) * time.Second,
+		MaxTTL: time.Duration(getEnvInt("SIGNED_URL_MAX_TTL_SECONDS", 7 * 24 * 3600)) * time.Second,
+	})
+	InitializeImporter(ImportOptions{
+		Timeout: time.Duration(getEnvInt("IMPORT_TIMEOUT_SECONDS", 15)) * time.Second,
+		MaxSize: int64(getEnvInt("IMPORT_MAX_BYTES", 10 << 20)),
+		MaxRedirects: getEnvInt("IMPORT_MAX_REDIRECTS", 3),
+	})
+	InitializeExports(ExportOptions{
+		Concurrency: getEnvInt("EXPORT_CONCURRENCY", 2),
+		LinkTTL: time.Duration(getEnvInt("EXPORT_LINK_TTL_SECONDS", 3600)) * time.Second,
+		Retention: time.Duration(getEnvInt("EXPORT_RETENTION_DAYS", 7)) * 24 * time.Hour,
+		MaintenanceInterval: time.Duration(getEnvInt("EXPORT_MAINTENANCE_INTERVAL_SECONDS", 60)) * time.Second,
+	})
+	StartWebhookDispatcher(WebhookDispatcherOptions{
+		Interval: time.Duration(getEnvInt("WEBHOOK_POLL_INTERVAL_MS", 1000)) * time.Millisecond,
+		BatchSize: getEnvInt("WEBHOOK_BATCH_SIZE", 20),
+		MaxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		Backoff: time.Duration(getEnvInt("WEBHOOK_BACKOFF_SECONDS", 30)) * time.Second,
+		Timeout: time.Duration(getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10)) * time.Second,
+	})
+	defer ClosePublisher()
 	defer CloseEventSubscriber()
 	defer CloseS3Connection()
 	corsHandler := cors.AllowAll().Handler(router)
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const memoryBrokerBufferSize = 1000
+
+type memoryJob struct {
+	message Message
+	priority int
+	// Delayed jobs are skipped by NextJob until this time
+	readyAt time.Time
+}
+
+type memoryProgressEvent struct {
+	message ImageProcessorProgressMessage
+	deliveries int
+}
+
+// MemoryBroker is an in-process Publisher and EventSubscriber for tests and local development without Redis.
+// Jobs wait until a worker takes them with NextJob, progress is reported with Report.
+type MemoryBroker struct {
+	mutex sync.Mutex
+	waiting []memoryJob
+	jobs map[string]*JobInfo
+	active map[string]bool
+	cancelled map[string]bool
+	sequences map[string]int64
+	backlog map[string][]ImageProcessorProgressMessage
+	// Signals NextJob that a job was added
+	jobAdded chan struct{}
+	reported chan memoryProgressEvent
+	delivered chan ImageProcessorProgressMessage
+	closed chan struct{}
+	closeOnce sync.Once
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	fmt.Println("Using in-memory broker, jobs are not shared with other processes")
+	return &MemoryBroker{
+		jobs: make(map[string]*JobInfo),
+		active: make(map[string]bool),
+		cancelled: make(map[string]bool),
+		sequences: make(map[string]int64),
+		backlog: make(map[string][]ImageProcessorProgressMessage),
+		jobAdded: make(chan struct{}, 1),
+		reported: make(chan memoryProgressEvent, memoryBrokerBufferSize),
+		delivered: make(chan ImageProcessorProgressMessage, memoryBrokerBufferSize),
+		closed: make(chan struct{}),
+	}
+}
+
+func (b *MemoryBroker) Publish(message Message) error {
+	jobOptions := publisherOptions.DefaultJobOptions
+	if message.JobOptions != nil {
+		jobOptions = *message.JobOptions
+	}
+	b.mutex.Lock()
+	// Like BullMQ, adding a job with the ID of an existing job is a no-op
+	if message.MessageId != "" && b.jobs[message.MessageId] != nil {
+		b.mutex.Unlock()
+		return nil
+	}
+	b.jobs[message.MessageId] = &JobInfo{Id: message.MessageId}
+	b.waiting = append(b.waiting, memoryJob{message: message, priority: jobOptions.Priority, readyAt: time.Now().Add(message.Delay)})
+	// Jobs without priority go first, then by priority, then in insertion order
+	sort.SliceStable(b.waiting, func(i, j int) bool {
+		return b.waiting[i].priority < b.waiting[j].priority
+	})
+	b.mutex.Unlock()
+	select {
+	case b.jobAdded <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// NextJob blocks until a job is ready and marks it active. Returns false when the context is done or the broker is closed.
+func (b *MemoryBroker) NextJob(ctx context.Context) (Message, bool) {
+	for {
+		b.mutex.Lock()
+		now := time.Now()
+		// Wake up when the next delayed job becomes ready
+		wait := time.Hour
+		for i, job := range b.waiting {
+			if !job.readyAt.After(now) {
+				b.waiting = append(b.waiting[:i], b.waiting[i+1:]...)
+				b.active[job.message.MessageId] = true
+				b.mutex.Unlock()
+				return job.message, true
+			}
+			if job.readyAt.Sub(now) < wait {
+				wait = job.readyAt.Sub(now)
+			}
+		}
+		b.mutex.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-b.jobAdded:
+		case <-ctx.Done():
+		case <-b.closed:
+		}
+		timer.Stop()
+		if ctx.Err() != nil || b.isClosed() {
+			return Message{}, false
+		}
+	}
+}
+
+// ConsumeJobs runs concurrency goroutines taking jobs until the broker is closed.
+// Failed jobs are retried in place with exponential backoff until their attempts are exhausted.
+func (b *MemoryBroker) ConsumeJobs(concurrency int, process JobProcessor) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-b.closed
+		cancel()
+	}()
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for {
+				message, ok := b.NextJob(ctx)
+				if !ok {
+					return
+				}
+				jobOptions := publisherOptions.DefaultJobOptions
+				if message.JobOptions != nil {
+					jobOptions = *message.JobOptions
+				}
+				attempts := jobOptions.Attempts
+				if attempts < 1 {
+					attempts = 1
+				}
+				var err error
+				attempt := 1
+				for ; attempt <= attempts; attempt++ {
+					err = process(ctx, message, attempt == attempts)
+					if err == nil || attempt == attempts {
+						break
+					}
+					backoff := time.Duration(jobOptions.BackoffDelay<<(attempt-1)) * time.Millisecond
+					select {
+					case <-time.After(backoff):
+					case <-ctx.Done():
+						return
+					}
+				}
+				b.finishJob(message.MessageId, attempt, err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (b *MemoryBroker) finishJob(jobId string, attemptsMade int, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.active, jobId)
+	job := b.jobs[jobId]
+	if job == nil {
+		return
+	}
+	job.AttemptsMade = attemptsMade
+	job.Finished = true
+	if err != nil {
+		job.FailedReason = err.Error()
+	}
+}
+
+func (b *MemoryBroker) GetJob(jobId string) (JobInfo, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if job := b.jobs[jobId]; job != nil {
+		return *job, nil
+	}
+	return JobInfo{}, nil
+}
+
+func (b *MemoryBroker) RemoveJob(jobId string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.active[jobId] {
+		return fmt.Errorf("failed to remove job: %s, the job is locked", jobId)
+	}
+	b.removeWaiting(jobId)
+	delete(b.jobs, jobId)
+	return nil
+}
+
+// removeWaiting must be called with the lock held
+func (b *MemoryBroker) removeWaiting(jobId string) {
+	for i, job := range b.waiting {
+		if job.message.MessageId == jobId {
+			b.waiting = append(b.waiting[:i], b.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *MemoryBroker) CancelJob(jobId string) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.active[jobId] {
+		return true, nil
+	}
+	b.removeWaiting(jobId)
+	delete(b.jobs, jobId)
+	return false, nil
+}
+
+func (b *MemoryBroker) PublishCancellation(imageID string, userId string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.cancelled[imageID] = true
+	return nil
+}
+
+func (b *MemoryBroker) ClearCancellation(imageID string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.cancelled, imageID)
+	return nil
+}
+
+// IsCancelled reports whether processing of the image should stop
+func (b *MemoryBroker) IsCancelled(imageID string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.cancelled[imageID]
+}
+
+func (b *MemoryBroker) Ping() error {
+	select {
+	case <-b.closed:
+		return errors.New("broker closed")
+	default:
+		return nil
+	}
+}
+
+func (b *MemoryBroker) isClosed() bool {
+	select {
+	case <-b.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *MemoryBroker) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+	})
+	return nil
+}
+
+func (b *MemoryBroker) Report(message ImageProcessorProgressMessage) error {
+	select {
+	case b.reported <- memoryProgressEvent{message: message}:
+		return nil
+	case <-b.closed:
+		return errors.New("broker closed")
+	default:
+		return errors.New("progress buffer full")
+	}
+}
+
+func (b *MemoryBroker) Consume(handle func(ImageProcessorProgressMessage) bool) {
+	for {
+		select {
+		case event := <-b.reported:
+			if handle(event.message) {
+				continue
+			}
+			event.deliveries++
+			if event.deliveries >= progressMaxDeliveries {
+				logStructured(ERROR, "Dropping progress event for image: "+event.message.ImageID, nil, 0, false)
+				continue
+			}
+			time.AfterFunc(progressReclaimInterval, func() {
+				select {
+				case b.reported <- event:
+				case <-b.closed:
+				}
+			})
+		case <-b.closed:
+			return
+		}
+	}
+}
+
+func (b *MemoryBroker) Deliver(message ImageProcessorProgressMessage) error {
+	b.mutex.Lock()
+	b.sequences[message.UserId]++
+	message.Seq = b.sequences[message.UserId]
+	backlog := append(b.backlog[message.UserId], message)
+	if len(backlog) > progressBacklogMaxLen {
+		backlog = backlog[len(backlog)-progressBacklogMaxLen:]
+	}
+	b.backlog[message.UserId] = backlog
+	b.mutex.Unlock()
+	select {
+	case b.delivered <- message:
+		return nil
+	default:
+		return errors.New("delivery buffer full")
+	}
+}
+
+func (b *MemoryBroker) FanOut(handle func(ImageProcessorProgressMessage)) {
+	for {
+		select {
+		case message := <-b.delivered:
+			handle(message)
+		case <-b.closed:
+			return
+		}
+	}
+}
+
+func (b *MemoryBroker) EventsSince(userId string, since int64) ([]ImageProcessorProgressMessage, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	messages := []ImageProcessorProgressMessage{}
+	for _, message := range b.backlog[userId] {
+		if message.Seq > since {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
@@ -18,4 +18,16 @@ type ImageSchema struct {
 	JOB_STATUS string `json:"job_status"`
 	COMPRESSED_AT sql.NullTime `json:"compressed_at"`
 	COMPRESSED_SIZE sql.NullInt64 `json:"compressed_size"`
+	ProcessingOptions ProcessingOptions `json:"processing_options"`
+	// When the job is released to workers, null when it is processed as soon as possible
+	ScheduledAt sql.NullTime `json:"scheduled_at"`
+	Description string `json:"description"`
+	Tags []string `json:"tags"`
+	// Name shown to users, filename stays the name used in storage keys
+	DisplayName string `json:"display_name"`
+	Metadata ImageMetadata `json:"metadata"`
+	// Version of the original in use, see imageObjectName
+	Version int `json:"version"`
+	// Set while the image is in the trash
+	DeletedAt sql.NullTime `json:"deleted_at"`
 }
\ No newline at end of file
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var ErrAddressNotAllowed = errors.New("address is not allowed")
+
+// Carrier-grade NAT and other ranges net.IP has no predicate for
+var blockedNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("240.0.0.0/4"),
+	mustParseCIDR("64:ff9b::/96"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// isPublicAddress rejects loopback, private, link-local, multicast and reserved addresses
+func isPublicAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newAddressCheckedClient returns a client for user supplied URLs that only connects to addresses allowAddress accepts,
+// redirects included
+func newAddressCheckedClient(timeout time.Duration, maxRedirects int, allowAddress func(ip net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		// Runs for every address actually dialed, after resolution, which also covers DNS rebinding
+		Control: func(network string, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !allowAddress(ip) {
+				return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		// Proxies would connect on our behalf and bypass the address check
+		Proxy: nil,
+		DialContext: dialer.DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConns: 10,
+		IdleConnTimeout: 30 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("redirect to unsupported scheme")
+			}
+			return nil
+		},
+	}
+}
+
+// checkHostAddresses fails with ErrAddressNotAllowed when the host resolves to an address allowAddress rejects.
+// It gives early feedback on stored URLs, connections are still checked when dialing since DNS answers change.
+func checkHostAddresses(ctx context.Context, host string, allowAddress func(ip net.IP) bool) error {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !allowAddress(ip) {
+			return fmt.Errorf("%w: %s", ErrAddressNotAllowed, ip)
+		}
+	}
+	return nil
+}
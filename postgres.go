@@ -2,9 +2,13 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 
@@ -16,10 +20,23 @@ type DBConfig struct {
 type ImagesResponse struct {
 	Images []ImageSchema `json:"images"`
 	TotalCount int `json:"count"`
+	// Pass as cursor to get the next page, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type ImageResponse struct {
 	Image ImageSchema `json:"image"`
+	Events []JobEvent `json:"events"`
+}
+
+type JobEvent struct {
+	ImageID string `json:"image_id"`
+	FromStatus sql.NullString `json:"from_status"`
+	ToStatus string `json:"to_status"`
+	Progress int `json:"progress"`
+	// Why the status changed when it was not reported by the executor
+	Reason sql.NullString `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 var DBConnection *sql.DB = nil
@@ -37,8 +54,43 @@ func GetDBConnection(config DBConfig) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = CreateJobEventsTable()
+	if err != nil {
+		return nil, err
+	}
+	err = CreateUserTiersTable()
+	if err != nil {
+		return nil, err
+	}
+	err = CreateWebhookTables()
+	if err != nil {
+		return nil, err
+	}
+	err = CreateAlbumTables()
+	if err != nil {
+		return nil, err
+	}
+	err = CreateExportsTable()
+	if err != nil {
+		return nil, err
+	}
+	err = CreateImageVersionsTable()
+	if err != nil {
+		return nil, err
+	}
+	err = CreateShareLinksTable()
+	if err != nil {
+		return nil, err
+	}
 	fmt.Println("Database connected successfully")
 	fmt.Println("Image table created successfully")
+	fmt.Println("Job events table created successfully")
+	fmt.Println("User tiers table created successfully")
+	fmt.Println("Webhook tables created successfully")
+	fmt.Println("Album tables created successfully")
+	fmt.Println("Exports table created successfully")
+	fmt.Println("Image versions table created successfully")
+	fmt.Println("Share links table created successfully")
 	return db, nil
 }
 
@@ -52,8 +104,72 @@ func CreateTable(db *sql.DB, tableName string, columns string) error {
 	return err
 }
 
+// imageMigrations add the columns introduced after the images table was first created
+var imageMigrations = []string{
+	"ALTER TABLE images ADD COLUMN IF NOT EXISTS processing_options JSONB NOT NULL DEFAULT '{}'",
+	"CREATE INDEX IF NOT EXISTS images_job_status_updated_at_idx ON images (job_status, updated_at)",
+	"ALTER TABLE images ADD COLUMN IF NOT EXISTS scheduled_at TIMESTAMP",
+	// Keyset pagination indexes, one per sort key of the listing API
+	"CREATE INDEX IF NOT EXISTS images_user_created_at_idx ON images (user_id, created_at, id)",
+	"CREATE INDEX IF NOT EXISTS images_user_size_idx ON images (user_id, size, id)",
+	"CREATE INDEX IF NOT EXISTS images_user_filename_idx ON images (user_id, filename, id)",
+	"CREATE INDEX IF NOT EXISTS images_user_compressed_size_idx ON images (user_id, (COALESCE(compressed_size, -1)), id)",
+	"CREATE INDEX IF NOT EXISTS images_user_job_status_idx ON images (user_id, job_status)",
+	"ALTER TABLE images ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE images ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}'",
+	"ALTER TABLE images ADD COLUMN IF NOT EXISTS search_vector TSVECTOR",
+	// filename is part of the storage keys, display_name is the name users can change
+	"ALTER TABLE images ADD COLUMN IF NOT EXISTS display_name TEXT",
+	"ALTER TABLE images ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'",
+	// array_to_string is not immutable so the search vector is maintained by a trigger instead of a generated column.
+	// Separators are replaced in filenames so that holiday_photo.jpg matches holiday and photo.
+	`CREATE OR REPLACE FUNCTION images_search_vector_update() RETURNS trigger AS $$
+	BEGIN
+		NEW.search_vector :=
+			setweight(to_tsvector('english', regexp_replace(COALESCE(NEW.display_name, NEW.filename), '[._-]+', ' ', 'g')), 'A') ||
+			setweight(to_tsvector('english', array_to_string(NEW.tags, ' ')), 'A') ||
+			setweight(to_tsvector('english', NEW.description), 'B');
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql`,
+	"DROP TRIGGER IF EXISTS images_search_vector_trigger ON images",
+	"CREATE TRIGGER images_search_vector_trigger BEFORE INSERT OR UPDATE OF filename, display_name, description, tags ON images FOR EACH ROW EXECUTE PROCEDURE images_search_vector_update()",
+	"UPDATE images SET description = description WHERE search_vector IS NULL",
+	"UPDATE images SET display_name = filename WHERE display_name IS NULL",
+	"ALTER TABLE images ALTER COLUMN display_name SET NOT NULL",
+	"CREATE INDEX IF NOT EXISTS images_search_vector_idx ON images USING GIN (search_vector)",
+	"CREATE INDEX IF NOT EXISTS images_tags_idx ON images USING GIN (tags)",
+	// version is the version currently in use, latest_version the last one handed out to a replacement
+	"ALTER TABLE images ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1",
+	"ALTER TABLE images ADD COLUMN IF NOT EXISTS latest_version INT NOT NULL DEFAULT 1",
+	// Trashed images are hidden from every query but the trash listing until they are restored or purged
+	"ALTER TABLE images ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP",
+	"CREATE INDEX IF NOT EXISTS images_deleted_at_idx ON images (deleted_at) WHERE deleted_at IS NOT NULL",
+}
+
+// jobEventMigrations add the columns introduced after the job_events table was first created
+var jobEventMigrations = []string{
+	"ALTER TABLE job_events ADD COLUMN IF NOT EXISTS reason TEXT",
+}
+
+// imageColumns lists the images columns in the order of imageScanTargets
+const imageColumns = "filename, size, format, width, height, user_id, created_at, updated_at, image_id, job_status, compressed_at, compressed_size, processing_options, scheduled_at, description, tags, display_name, metadata, version, deleted_at"
+
+// imageColumnsOf qualifies imageColumns with a table alias for joins
+func imageColumnsOf(alias string) string {
+	columns := strings.Split(imageColumns, ", ")
+	for i, column := range columns {
+		columns[i] = alias + "." + column
+	}
+	return strings.Join(columns, ", ")
+}
+
+func imageScanTargets(image *ImageSchema) []interface{} {
+	return []interface{}{&image.Filename, &image.Size, &image.Format, &image.Width, &image.Height, &image.UserId, &image.CreatedAt, &image.UpdatedAt, &image.ImageID, &image.JOB_STATUS, &image.COMPRESSED_AT, &image.COMPRESSED_SIZE, &image.ProcessingOptions, &image.ScheduledAt, &image.Description, pq.Array(&image.Tags), &image.DisplayName, &image.Metadata, &image.Version, &image.DeletedAt}
+}
+
 func CreateImageTable() error {
-	return CreateTable(DBConnection, "images", `
+	err := CreateTable(DBConnection, "images", `
 		id SERIAL PRIMARY KEY,
 		filename TEXT NOT NULL,
 		size INT NOT NULL,
@@ -68,50 +184,1273 @@ func CreateImageTable() error {
 		compressed_at TIMESTAMP,
 		compressed_size INT
 	`)
+	if err != nil {
+		return err
+	}
+	for _, migration := range imageMigrations {
+		_, err = DBConnection.Exec(migration)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func InsertImage(image ImageSchema) error {
-	_, err := DBConnection.Exec("INSERT INTO images (filename, size, format, width, height, user_id, created_at, updated_at, image_id,job_status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)", image.Filename, image.Size, image.Format, image.Width, image.Height, image.UserId, image.CreatedAt, image.UpdatedAt, image.ImageID,image.JOB_STATUS)
+func CreateJobEventsTable() error {
+	err := CreateTable(DBConnection, "job_events", `
+		id SERIAL PRIMARY KEY,
+		image_id TEXT NOT NULL REFERENCES images(image_id) ON DELETE CASCADE,
+		from_status TEXT,
+		to_status TEXT NOT NULL,
+		progress INT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = DBConnection.Exec("CREATE INDEX IF NOT EXISTS job_events_image_id_idx ON job_events (image_id, created_at)")
+	if err != nil {
+		return err
+	}
+	for _, migration := range jobEventMigrations {
+		_, err = DBConnection.Exec(migration)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func CreateUserTiersTable() error {
+	return CreateTable(DBConnection, "user_tiers", `
+		user_id TEXT PRIMARY KEY,
+		tier TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	`)
+}
+
+// GetUserTier returns the user's tier, users without one are standard
+func GetUserTier(userId string) (UserTier, error) {
+	var tier string
+	err := DBConnection.QueryRow("SELECT tier FROM user_tiers WHERE user_id = $1", userId).Scan(&tier)
+	if err == sql.ErrNoRows {
+		return TierStandard, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return UserTier(tier), nil
+}
+
+func SetUserTier(userId string, tier UserTier) error {
+	_, err := DBConnection.Exec("INSERT INTO user_tiers (user_id, tier, updated_at) VALUES ($1, $2, $3) ON CONFLICT (user_id) DO UPDATE SET tier = EXCLUDED.tier, updated_at = EXCLUDED.updated_at", userId, tier, time.Now())
+	return err
+}
+
+// GetStaleImages returns unfinished images that were not updated since before and were due by then, oldest first
+func GetStaleImages(before time.Time, limit int) ([]ImageSchema, error) {
+	rows, err := DBConnection.Query("SELECT "+imageColumns+" FROM images WHERE job_status IN ($1, $2) AND deleted_at IS NULL AND updated_at < $3 AND (scheduled_at IS NULL OR scheduled_at < $3) ORDER BY updated_at LIMIT $4", JobInQueue, JobProcessing, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	images := []ImageSchema{}
+	for rows.Next() {
+		var image ImageSchema
+		err := rows.Scan(imageScanTargets(&image)...)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// SetImageSchedule changes when an image waiting in the queue is processed, returns false when it is no longer waiting
+func SetImageSchedule(imageID string, userId string, scheduledAt sql.NullTime) (bool, error) {
+	result, err := DBConnection.Exec("UPDATE images SET scheduled_at = $1, updated_at = $2 WHERE image_id = $3 AND user_id = $4 AND job_status = $5 AND deleted_at IS NULL", scheduledAt, time.Now(), imageID, userId, JobInQueue)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// CountUnfinishedImages counts the user's images whose job is queued or being processed
+func CountUnfinishedImages(userId string) (int, error) {
+	var count int
+	err := DBConnection.QueryRow("SELECT count(*) FROM images WHERE user_id = $1 AND job_status IN ($2, $3)", userId, JobInQueue, JobProcessing).Scan(&count)
+	return count, err
+}
+
+func insertJobEvent(tx *sql.Tx, event JobEvent) error {
+	_, err := tx.Exec("INSERT INTO job_events (image_id, from_status, to_status, progress, reason, created_at) VALUES ($1, $2, $3, $4, $5, $6)", event.ImageID, event.FromStatus, event.ToStatus, event.Progress, event.Reason, event.CreatedAt)
 	return err
 }
 
-func GetImagesByUserId(userId string, skip int, limit int, jobsStatus string) (ImagesResponse, error) {
-	query := ""
-	var rows *sql.Rows = nil;
-	var err error = nil;
-	if jobsStatus == "" {
-		query = "SELECT * ,count(*) OVER() AS total_count FROM images WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3"
-		rows, err = DBConnection.Query(query, userId, limit, skip)
+func InsertImage(image ImageSchema) error {
+	tx, err := DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("INSERT INTO images (filename, size, format, width, height, user_id, created_at, updated_at, image_id,job_status, processing_options, scheduled_at, description, tags, display_name, metadata) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)", image.Filename, image.Size, image.Format, image.Width, image.Height, image.UserId, image.CreatedAt, image.UpdatedAt, image.ImageID,image.JOB_STATUS, image.ProcessingOptions, image.ScheduledAt, image.Description, pq.Array(image.Tags), image.DisplayName, image.Metadata)
+	if err != nil {
+		return err
+	}
+	err = insertJobEvent(tx, JobEvent{ImageID: image.ImageID, ToStatus: image.JOB_STATUS, CreatedAt: image.CreatedAt})
+	if err != nil {
+		return err
+	}
+	err = insertImageVersion(tx, imageVersionOf(image, 1, image.CreatedAt))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type JobTransition struct {
+	ImageID string
+	UserId string
+	Status JobStatus
+	Progress int
+	// Recorded as compressed_size when moving to completed, ignored when 0
+	CompressedSize int64
+	// Recorded on the job event, empty for transitions reported by the executor
+	Reason string
+	// When set the transition fails with ErrJobChanged if the image was updated after this time
+	UnchangedSince time.Time
+	// Moves the image back in queue for reprocessing, only from the statuses ValidateRequeue accepts
+	Requeue bool
+	// With Requeue, also lets a completed image move back in queue so it is compressed again
+	Recompress bool
+}
+
+// TransitionJobStatus moves the image's job to a new status and records it in job_events.
+// Returns ErrIllegalJobTransition without modifying anything when the state machine rejects the change.
+func TransitionJobStatus(transition JobTransition) error {
+	tx, err := DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var currentStatus string
+	var updatedAt time.Time
+	var filename string
+	err = tx.QueryRow("SELECT job_status, updated_at, filename FROM images WHERE image_id = $1 AND user_id = $2 FOR UPDATE", transition.ImageID, transition.UserId).Scan(&currentStatus, &updatedAt, &filename)
+	if err != nil {
+		return err
+	}
+	if !transition.UnchangedSince.IsZero() && updatedAt.After(transition.UnchangedSince) {
+		return ErrJobChanged
+	}
+	nextStatus := transition.Status
+	if transition.Requeue {
+		nextStatus = JobInQueue
+		err = ValidateRequeue(JobStatus(currentStatus), transition.Recompress)
+	} else {
+		err = ValidateJobTransition(JobStatus(currentStatus), nextStatus)
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if nextStatus == JobCompleted {
+		compressedSize := sql.NullInt64{Int64: transition.CompressedSize, Valid: transition.CompressedSize > 0}
+		_, err = tx.Exec("UPDATE images SET job_status = $1, updated_at = $2, compressed_at = $2, compressed_size = COALESCE($3, compressed_size) WHERE image_id = $4", nextStatus, now, compressedSize, transition.ImageID)
 	} else {
-		query = "SELECT * ,count(*) OVER() AS total_count FROM images WHERE user_id = $1 AND job_status = $2 ORDER BY created_at DESC LIMIT $3 OFFSET $4"
-		rows, err = DBConnection.Query(query, userId, jobsStatus, limit, skip)
+		_, err = tx.Exec("UPDATE images SET job_status = $1, updated_at = $2 WHERE image_id = $3", nextStatus, now, transition.ImageID)
+	}
+	if err != nil {
+		return err
+	}
+	err = insertJobEvent(tx, JobEvent{
+		ImageID: transition.ImageID,
+		FromStatus: sql.NullString{String: currentStatus, Valid: true},
+		ToStatus: string(nextStatus),
+		Progress: transition.Progress,
+		Reason: sql.NullString{String: transition.Reason, Valid: transition.Reason != ""},
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	// Deliveries are queued in the same transaction so a finished job is never missed or reported twice
+	if event, ok := webhookEventForStatus(nextStatus); ok {
+		err = queueWebhookDeliveries(tx, transition.UserId, event, WebhookEventData{
+			ImageID: transition.ImageID,
+			UserId: transition.UserId,
+			Filename: filename,
+			Status: string(nextStatus),
+			CompressedSize: transition.CompressedSize,
+			Reason: transition.Reason,
+		}, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ApplyJobProgress moves the image's job to the status reported by the progress event
+func ApplyJobProgress(message ImageProcessorProgressMessage) error {
+	return TransitionJobStatus(JobTransition{
+		ImageID: message.ImageID,
+		UserId: message.UserId,
+		Status: JobStatus(message.Status),
+		Progress: message.Progress,
+		CompressedSize: message.CompressedSize,
+	})
+}
+
+func GetJobEvents(imageID string) ([]JobEvent, error) {
+	rows, err := DBConnection.Query("SELECT image_id, from_status, to_status, progress, reason, created_at FROM job_events WHERE image_id = $1 ORDER BY created_at, id", imageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []JobEvent{}
+	for rows.Next() {
+		var event JobEvent
+		err := rows.Scan(&event.ImageID, &event.FromStatus, &event.ToStatus, &event.Progress, &event.Reason, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// GetImagesByUserId returns a page of the user's images, paged by cursor when query.Cursor is set and by offset otherwise.
+// The total count covers all images matching the filters.
+func GetImagesByUserId(userId string, query ImageListQuery) (ImagesResponse, error) {
+	where, args := query.filterClause(userId)
+	totalCount := 0
+	err := DBConnection.QueryRow("SELECT count(*) FROM images WHERE "+where, args...).Scan(&totalCount)
+	if err != nil {
+		return ImagesResponse{}, err
+	}
+
+	sortExpression := imageSortExpressions[query.Sort]
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if query.Cursor != nil {
+		value, err := query.Cursor.queryValue()
+		if err != nil {
+			return ImagesResponse{}, errors.New("invalid cursor")
+		}
+		// The row ID breaks ties between images with the same sort value
+		args = append(args, value, query.Cursor.ID)
+		where += fmt.Sprintf(" AND (%s, id) %s ($%d, $%d)", sortExpression, comparison, len(args)-1, len(args))
 	}
+	// One extra row tells whether there is a next page
+	args = append(args, query.Limit+1, query.Skip)
+	rows, err := DBConnection.Query(fmt.Sprintf("SELECT id, %s FROM images WHERE %s ORDER BY %s %s, id %s LIMIT $%d OFFSET $%d", imageColumns, where, sortExpression, direction, direction, len(args)-1, len(args)), args...)
 	if err != nil {
 		return ImagesResponse{}, err
 	}
 	defer rows.Close()
 	images := []ImageSchema{}
-	totalCount := 0
-	// var totalCount int
+	lastID := int64(0)
+	hasMore := false
 	for rows.Next() {
+		if len(images) == query.Limit {
+			hasMore = true
+			break
+		}
 		var image ImageSchema
-		err := rows.Scan(&image.ImageID, &image.Filename, &image.Size, &image.Format, &image.Width, &image.Height, &image.UserId, &image.CreatedAt, &image.UpdatedAt, &image.ImageID, &image.JOB_STATUS, &image.COMPRESSED_AT, &image.COMPRESSED_SIZE, &totalCount)
+		err := rows.Scan(append([]interface{}{&lastID}, imageScanTargets(&image)...)...)
 		if err != nil {
 			return ImagesResponse{}, err
 		}
 		images = append(images, image)
 	}
-	return ImagesResponse{Images: images, TotalCount: totalCount}, nil
+	if err := rows.Err(); err != nil {
+		return ImagesResponse{}, err
+	}
+	response := ImagesResponse{Images: images, TotalCount: totalCount}
+	if hasMore {
+		response.NextCursor = encodeImageCursor(imageCursor{
+			Sort: query.Sort,
+			Descending: query.Descending,
+			Value: cursorSortValue(images[len(images)-1], query.Sort),
+			ID: lastID,
+		})
+	}
+	return response, nil
 }
 
 func GetImageById(imageID string, userId string) (ImageResponse, error) {
-	query := "SELECT * FROM images WHERE image_id = $1 AND user_id = $2"
+	query := "SELECT " + imageColumns + " FROM images WHERE image_id = $1 AND user_id = $2 AND deleted_at IS NULL"
 	row := DBConnection.QueryRow(query, imageID, userId)
 	var image ImageSchema
-	err := row.Scan(&image.ImageID, &image.Filename, &image.Size, &image.Format, &image.Width, &image.Height, &image.UserId, &image.CreatedAt, &image.UpdatedAt, &image.ImageID, &image.JOB_STATUS, &image.COMPRESSED_AT, &image.COMPRESSED_SIZE)
+	err := row.Scan(imageScanTargets(&image)...)
+	if err != nil {
+		return ImageResponse{}, err
+	}
+	events, err := GetJobEvents(imageID)
 	if err != nil {
 		return ImageResponse{}, err
 	}
-	response := ImageResponse{Image: image}
+	response := ImageResponse{Image: image, Events: events}
 	return response, nil	
-}
\ No newline at end of file
+}
+func CreateWebhookTables() error {
+	err := CreateTable(DBConnection, "webhooks", `
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT[] NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = DBConnection.Exec("CREATE INDEX IF NOT EXISTS webhooks_user_id_idx ON webhooks (user_id)")
+	if err != nil {
+		return err
+	}
+	err = CreateTable(DBConnection, "webhook_deliveries", `
+		id SERIAL PRIMARY KEY,
+		webhook_id TEXT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		event TEXT NOT NULL,
+		payload JSONB NOT NULL,
+		status TEXT NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		response_status INT,
+		last_error TEXT,
+		last_attempt_at TIMESTAMP,
+		next_attempt_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = DBConnection.Exec("CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at)")
+	if err != nil {
+		return err
+	}
+	_, err = DBConnection.Exec("CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at)")
+	if err != nil {
+		return err
+	}
+	// Errors used to include the response body, which could come from internal services
+	_, err = DBConnection.Exec("UPDATE webhook_deliveries SET last_error = 'unexpected status ' || response_status WHERE response_status IS NOT NULL AND last_error LIKE 'unexpected status %: %'")
+	return err
+}
+
+func InsertWebhook(webhook Webhook) error {
+	_, err := DBConnection.Exec("INSERT INTO webhooks (id, user_id, url, secret, events, created_at) VALUES ($1, $2, $3, $4, $5, $6)", webhook.ID, webhook.UserId, webhook.URL, webhook.Secret, pq.Array(webhook.Events), webhook.CreatedAt)
+	return err
+}
+
+// GetWebhooks returns the webhooks of the user without their secrets
+func GetWebhooks(userId string) ([]Webhook, error) {
+	rows, err := DBConnection.Query("SELECT id, user_id, url, events, created_at FROM webhooks WHERE user_id = $1 ORDER BY created_at", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(&webhook.ID, &webhook.UserId, &webhook.URL, pq.Array(&webhook.Events), &webhook.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook returns false when the user has no such webhook
+func DeleteWebhook(webhookId string, userId string) (bool, error) {
+	result, err := DBConnection.Exec("DELETE FROM webhooks WHERE id = $1 AND user_id = $2", webhookId, userId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// queueWebhookDeliveries adds a pending delivery for every webhook of the user subscribed to the event
+func queueWebhookDeliveries(tx *sql.Tx, userId string, event string, data WebhookEventData, now time.Time) error {
+	payload, err := jsonStringify(WebhookPayload{Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at) SELECT id, $1, $2, $3, $4, $4 FROM webhooks WHERE user_id = $5 AND $1 = ANY(events)", event, payload, WebhookDeliveryPending, now, userId)
+	return err
+}
+
+// ClaimWebhookDelivery returns the next due delivery and hides it from other dispatchers until leaseUntil
+func ClaimWebhookDelivery(leaseUntil time.Time) (webhookDeliveryTask, error) {
+	var task webhookDeliveryTask
+	err := DBConnection.QueryRow(`
+		WITH claimed AS (
+			UPDATE webhook_deliveries SET next_attempt_at = $1
+			WHERE id = (
+				SELECT id FROM webhook_deliveries
+				WHERE status = $2 AND next_attempt_at <= $3
+				ORDER BY next_attempt_at
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, webhook_id, event, payload, attempts
+		)
+		SELECT claimed.id, claimed.event, claimed.payload, claimed.attempts, webhooks.url, webhooks.secret
+		FROM claimed JOIN webhooks ON webhooks.id = claimed.webhook_id`, leaseUntil, WebhookDeliveryPending, time.Now()).Scan(&task.ID, &task.Event, &task.Payload, &task.Attempts, &task.URL, &task.Secret)
+	return task, err
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt, nextAttemptAt is only used while the delivery stays pending
+func RecordWebhookAttempt(deliveryId int64, status string, responseStatus sql.NullInt64, lastError sql.NullString, nextAttemptAt sql.NullTime) error {
+	_, err := DBConnection.Exec("UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_status = $2, last_error = $3, last_attempt_at = $4, next_attempt_at = $5 WHERE id = $6", status, responseStatus, lastError, time.Now(), nextAttemptAt, deliveryId)
+	return err
+}
+
+func GetWebhookDeliveries(webhookId string, userId string, limit int) ([]WebhookDelivery, error) {
+	rows, err := DBConnection.Query(`
+		SELECT d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.response_status, d.last_error, d.last_attempt_at, d.next_attempt_at, d.created_at
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.webhook_id = $1 AND w.user_id = $2
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT $3`, webhookId, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload string
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts, &delivery.ResponseStatus, &delivery.LastError, &delivery.LastAttemptAt, &delivery.NextAttemptAt, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// RedeliverWebhook makes a delivery of the user's webhook pending again with a fresh set of attempts
+func RedeliverWebhook(deliveryId int64, webhookId string, userId string) (bool, error) {
+	result, err := DBConnection.Exec(`
+		UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2
+		WHERE id = $3 AND webhook_id = $4 AND webhook_id IN (SELECT id FROM webhooks WHERE user_id = $5)`, WebhookDeliveryPending, time.Now(), deliveryId, webhookId, userId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// SetImageTags replaces the tags of the image and returns the stored tags
+func SetImageTags(imageID string, userId string, tags []string) ([]string, error) {
+	var stored []string
+	err := DBConnection.QueryRow("UPDATE images SET tags = $1, updated_at = $2 WHERE image_id = $3 AND user_id = $4 AND deleted_at IS NULL RETURNING tags", pq.Array(tags), time.Now(), imageID, userId).Scan(pq.Array(&stored))
+	return stored, err
+}
+
+// AddImageTags adds tags the image does not have yet and returns the stored tags
+func AddImageTags(imageID string, userId string, tags []string) ([]string, error) {
+	var stored []string
+	err := DBConnection.QueryRow(`
+		UPDATE images SET tags = ARRAY(SELECT DISTINCT unnest(tags || $1::TEXT[]) ORDER BY 1), updated_at = $2
+		WHERE image_id = $3 AND user_id = $4 AND deleted_at IS NULL RETURNING tags`, pq.Array(tags), time.Now(), imageID, userId).Scan(pq.Array(&stored))
+	return stored, err
+}
+
+func RemoveImageTag(imageID string, userId string, tag string) ([]string, error) {
+	var stored []string
+	err := DBConnection.QueryRow("UPDATE images SET tags = array_remove(tags, $1), updated_at = $2 WHERE image_id = $3 AND user_id = $4 AND deleted_at IS NULL RETURNING tags", tag, time.Now(), imageID, userId).Scan(pq.Array(&stored))
+	return stored, err
+}
+
+func SetImageDescription(imageID string, userId string, description string) error {
+	result, err := DBConnection.Exec("UPDATE images SET description = $1, updated_at = $2 WHERE image_id = $3 AND user_id = $4 AND deleted_at IS NULL", description, time.Now(), imageID, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// GetUserTags returns every tag of the user's images with the number of images carrying it
+func GetUserTags(userId string) ([]TagCount, error) {
+	rows, err := DBConnection.Query("SELECT tag, count(*) FROM images, unnest(tags) AS tag WHERE user_id = $1 AND deleted_at IS NULL GROUP BY tag ORDER BY tag", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		err := rows.Scan(&tag.Tag, &tag.Count)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// SearchImages ranks the user's images matching the full-text query and carrying all tags.
+// An empty text only filters by tags, newest first.
+func SearchImages(userId string, text string, tags []string, skip int, limit int) (ImagesResponse, error) {
+	rows, err := DBConnection.Query(`
+		SELECT `+imageColumns+`, count(*) OVER() AS total_count
+		FROM images, websearch_to_tsquery('english', $2) AS query
+		WHERE user_id = $1 AND deleted_at IS NULL AND ($2 = '' OR search_vector @@ query) AND tags @> $3
+		ORDER BY ts_rank(search_vector, query) DESC, created_at DESC, id DESC
+		LIMIT $4 OFFSET $5`, userId, text, pq.Array(tags), limit, skip)
+	if err != nil {
+		return ImagesResponse{}, err
+	}
+	defer rows.Close()
+	images := []ImageSchema{}
+	totalCount := 0
+	for rows.Next() {
+		var image ImageSchema
+		err := rows.Scan(append(imageScanTargets(&image), &totalCount)...)
+		if err != nil {
+			return ImagesResponse{}, err
+		}
+		images = append(images, image)
+	}
+	return ImagesResponse{Images: images, TotalCount: totalCount}, rows.Err()
+}
+
+func CreateAlbumTables() error {
+	err := CreateTable(DBConnection, "albums", `
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		cover_image_id TEXT REFERENCES images(image_id) ON DELETE SET NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = DBConnection.Exec("CREATE INDEX IF NOT EXISTS albums_user_id_idx ON albums (user_id, created_at)")
+	if err != nil {
+		return err
+	}
+	err = CreateTable(DBConnection, "album_images", `
+		album_id TEXT NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+		image_id TEXT NOT NULL REFERENCES images(image_id) ON DELETE CASCADE,
+		position INT NOT NULL,
+		added_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (album_id, image_id)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = DBConnection.Exec("CREATE INDEX IF NOT EXISTS album_images_position_idx ON album_images (album_id, position)")
+	if err != nil {
+		return err
+	}
+	_, err = DBConnection.Exec("CREATE INDEX IF NOT EXISTS album_images_image_id_idx ON album_images (image_id)")
+	return err
+}
+
+// albumQuery selects albums with their image count and cover, which defaults to the first image of the album
+const albumQuery = `
+	SELECT a.id, a.user_id, a.name, a.description, a.cover_image_id, a.created_at, a.updated_at,
+		(SELECT count(*) FROM album_images ai JOIN images i ON i.image_id = ai.image_id WHERE ai.album_id = a.id AND i.deleted_at IS NULL), cover.image_id, cover.filename, cover.version
+	FROM albums a
+	LEFT JOIN images cover ON cover.image_id = COALESCE(a.cover_image_id, (SELECT image_id FROM album_images WHERE album_id = a.id ORDER BY position LIMIT 1)) AND cover.deleted_at IS NULL`
+
+func scanAlbum(scanner interface{ Scan(...interface{}) error }) (Album, error) {
+	var album Album
+	var coverID, coverFilename sql.NullString
+	var coverVersion sql.NullInt64
+	err := scanner.Scan(&album.ID, &album.UserId, &album.Name, &album.Description, &album.CoverImageID, &album.CreatedAt, &album.UpdatedAt, &album.ImageCount, &coverID, &coverFilename, &coverVersion)
+	if err != nil {
+		return album, err
+	}
+	if coverID.Valid {
+		album.CoverThumbnail = fmt.Sprintf("%s/%s/%s/%s", Thumbnail, album.UserId, coverID.String, imageObjectName(coverFilename.String, int(coverVersion.Int64)))
+	}
+	return album, nil
+}
+
+func InsertAlbum(album Album) error {
+	_, err := DBConnection.Exec("INSERT INTO albums (id, user_id, name, description, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)", album.ID, album.UserId, album.Name, album.Description, album.CreatedAt, album.UpdatedAt)
+	return err
+}
+
+func GetAlbums(userId string) ([]Album, error) {
+	rows, err := DBConnection.Query(albumQuery+" WHERE a.user_id = $1 ORDER BY a.created_at DESC", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	albums := []Album{}
+	for rows.Next() {
+		album, err := scanAlbum(rows)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, rows.Err()
+}
+
+func GetAlbum(albumId string, userId string) (Album, error) {
+	return scanAlbum(DBConnection.QueryRow(albumQuery+" WHERE a.id = $1 AND a.user_id = $2", albumId, userId))
+}
+
+// GetAlbumImages returns the images of the album in album order
+func GetAlbumImages(albumId string) ([]ImageSchema, error) {
+	rows, err := DBConnection.Query("SELECT "+imageColumnsOf("i")+" FROM album_images ai JOIN images i ON i.image_id = ai.image_id WHERE ai.album_id = $1 AND i.deleted_at IS NULL ORDER BY ai.position", albumId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	images := []ImageSchema{}
+	for rows.Next() {
+		var image ImageSchema
+		err := rows.Scan(imageScanTargets(&image)...)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// UpdateAlbum applies the non-nil fields, the cover must be an image of the album
+func UpdateAlbum(albumId string, userId string, update AlbumUpdate) error {
+	tx, err := DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var exists bool
+	err = tx.QueryRow("SELECT true FROM albums WHERE id = $1 AND user_id = $2 FOR UPDATE", albumId, userId).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if update.Name != nil {
+		_, err = tx.Exec("UPDATE albums SET name = $1, updated_at = $2 WHERE id = $3", *update.Name, now, albumId)
+		if err != nil {
+			return err
+		}
+	}
+	if update.Description != nil {
+		_, err = tx.Exec("UPDATE albums SET description = $1, updated_at = $2 WHERE id = $3", *update.Description, now, albumId)
+		if err != nil {
+			return err
+		}
+	}
+	if update.CoverImageID != nil {
+		cover := sql.NullString{String: *update.CoverImageID, Valid: *update.CoverImageID != ""}
+		if cover.Valid {
+			var inAlbum bool
+			err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM album_images WHERE album_id = $1 AND image_id = $2)", albumId, cover.String).Scan(&inAlbum)
+			if err != nil {
+				return err
+			}
+			if !inAlbum {
+				return ErrImageNotInAlbum
+			}
+		}
+		_, err = tx.Exec("UPDATE albums SET cover_image_id = $1, updated_at = $2 WHERE id = $3", cover, now, albumId)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func DeleteAlbum(albumId string, userId string) (bool, error) {
+	result, err := DBConnection.Exec("DELETE FROM albums WHERE id = $1 AND user_id = $2", albumId, userId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// AddAlbumImages appends the user's images to the album, images already in it keep their position
+func AddAlbumImages(albumId string, userId string, imageIDs []string) error {
+	tx, err := DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var position int
+	err = tx.QueryRow("SELECT COALESCE((SELECT max(position) FROM album_images WHERE album_id = a.id), 0) FROM albums a WHERE a.id = $1 AND a.user_id = $2 FOR UPDATE", albumId, userId).Scan(&position)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, imageID := range imageIDs {
+		var owned bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM images WHERE image_id = $1 AND user_id = $2 AND deleted_at IS NULL)", imageID, userId).Scan(&owned)
+		if err != nil {
+			return err
+		}
+		if !owned {
+			return fmt.Errorf("%w: %s", ErrUnknownImage, imageID)
+		}
+		result, err := tx.Exec("INSERT INTO album_images (album_id, image_id, position, added_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING", albumId, imageID, position+1, now)
+		if err != nil {
+			return err
+		}
+		if added, _ := result.RowsAffected(); added > 0 {
+			position++
+		}
+	}
+	_, err = tx.Exec("UPDATE albums SET updated_at = $1 WHERE id = $2", now, albumId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveAlbumImage returns false when the image is not in the user's album
+func RemoveAlbumImage(albumId string, userId string, imageID string) (bool, error) {
+	tx, err := DBConnection.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("DELETE FROM album_images WHERE album_id = $1 AND image_id = $2 AND album_id IN (SELECT id FROM albums WHERE user_id = $3)", albumId, imageID, userId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false, err
+	}
+	_, err = tx.Exec("UPDATE albums SET cover_image_id = CASE WHEN cover_image_id = $1 THEN NULL ELSE cover_image_id END, updated_at = $2 WHERE id = $3", imageID, time.Now(), albumId)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ReorderAlbumImages sets the album order, imageIDs must list every image of the album exactly once.
+// Trashed images are hidden from album listings so they are not part of imageIDs, they keep their relative order after the others.
+func ReorderAlbumImages(albumId string, userId string, imageIDs []string) error {
+	tx, err := DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var exists bool
+	err = tx.QueryRow("SELECT true FROM albums WHERE id = $1 AND user_id = $2 FOR UPDATE", albumId, userId).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	var count int
+	err = tx.QueryRow("SELECT count(*) FROM album_images ai JOIN images i ON i.image_id = ai.image_id WHERE ai.album_id = $1 AND ai.image_id = ANY($2) AND i.deleted_at IS NULL", albumId, pq.Array(imageIDs)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	var total int
+	err = tx.QueryRow("SELECT count(*) FROM album_images ai JOIN images i ON i.image_id = ai.image_id WHERE ai.album_id = $1 AND i.deleted_at IS NULL", albumId).Scan(&total)
+	if err != nil {
+		return err
+	}
+	if count != len(imageIDs) || total != len(imageIDs) {
+		return ErrInvalidAlbumOrder
+	}
+	for i, imageID := range imageIDs {
+		_, err = tx.Exec("UPDATE album_images SET position = $1 WHERE album_id = $2 AND image_id = $3", i+1, albumId, imageID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		UPDATE album_images SET position = $2 + trashed.rank
+		FROM (
+			SELECT ai.image_id, row_number() OVER (ORDER BY ai.position) AS rank
+			FROM album_images ai JOIN images i ON i.image_id = ai.image_id
+			WHERE ai.album_id = $1 AND i.deleted_at IS NOT NULL
+		) trashed
+		WHERE album_images.album_id = $1 AND album_images.image_id = trashed.image_id`, albumId, len(imageIDs))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE albums SET updated_at = $1 WHERE id = $2", time.Now(), albumId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func CreateExportsTable() error {
+	err := CreateTable(DBConnection, "exports", `
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		include_compressed BOOLEAN NOT NULL,
+		total INT NOT NULL DEFAULT 0,
+		processed INT NOT NULL DEFAULT 0,
+		storage_key TEXT,
+		size BIGINT,
+		error TEXT,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		completed_at TIMESTAMP
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = DBConnection.Exec("CREATE INDEX IF NOT EXISTS exports_user_id_idx ON exports (user_id, created_at)")
+	return err
+}
+
+const exportColumns = "id, user_id, status, include_compressed, total, processed, storage_key, size, error, created_at, updated_at, completed_at"
+
+func scanExport(scanner interface{ Scan(...interface{}) error }) (Export, error) {
+	var export Export
+	err := scanner.Scan(&export.ID, &export.UserId, &export.Status, &export.IncludeCompressed, &export.Total, &export.Processed, &export.StorageKey, &export.Size, &export.Error, &export.CreatedAt, &export.UpdatedAt, &export.CompletedAt)
+	return export, err
+}
+
+// InsertExport creates the export unless the user already has one pending or running, in which case it returns false
+func InsertExport(export Export) (bool, error) {
+	result, err := DBConnection.Exec(`
+		INSERT INTO exports (id, user_id, status, include_compressed, created_at, updated_at)
+		SELECT $1, $2, $3, $4, $5, $5
+		WHERE NOT EXISTS (SELECT 1 FROM exports WHERE user_id = $2 AND status IN ($3, $6))`, export.ID, export.UserId, export.Status, export.IncludeCompressed, export.CreatedAt, ExportRunning)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func GetExport(exportId string, userId string) (Export, error) {
+	return scanExport(DBConnection.QueryRow("SELECT "+exportColumns+" FROM exports WHERE id = $1 AND user_id = $2", exportId, userId))
+}
+
+func GetExports(userId string) ([]Export, error) {
+	rows, err := DBConnection.Query("SELECT "+exportColumns+" FROM exports WHERE user_id = $1 ORDER BY created_at DESC", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	exports := []Export{}
+	for rows.Next() {
+		export, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+	return exports, rows.Err()
+}
+
+// UpdateExportProgress returns ErrExportStopped when the export is no longer pending or running, e.g. when it was failed as interrupted
+func UpdateExportProgress(exportId string, status string, total int, processed int) error {
+	result, err := DBConnection.Exec("UPDATE exports SET status = $1, total = $2, processed = $3, updated_at = $4 WHERE id = $5 AND status IN ($6, $7)", status, total, processed, time.Now(), exportId, ExportPending, ExportRunning)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		err = ErrExportStopped
+	}
+	return err
+}
+
+// TouchExport is the heartbeat of unfinished exports, exports that already finished are left alone
+func TouchExport(exportId string) error {
+	_, err := DBConnection.Exec("UPDATE exports SET updated_at = $1 WHERE id = $2 AND status IN ($3, $4)", time.Now(), exportId, ExportPending, ExportRunning)
+	return err
+}
+
+func CompleteExport(exportId string, storageKey string, size int64) error {
+	now := time.Now()
+	_, err := DBConnection.Exec("UPDATE exports SET status = $1, storage_key = $2, size = $3, updated_at = $4, completed_at = $4 WHERE id = $5", ExportCompleted, storageKey, size, now, exportId)
+	return err
+}
+
+func FailExport(exportId string, reason string) error {
+	now := time.Now()
+	_, err := DBConnection.Exec("UPDATE exports SET status = $1, error = $2, updated_at = $3, completed_at = $3 WHERE id = $4", ExportFailed, reason, now, exportId)
+	return err
+}
+
+// FailStaleExports fails unfinished exports whose process stopped updating them before the given time
+func FailStaleExports(before time.Time) (int64, error) {
+	now := time.Now()
+	result, err := DBConnection.Exec("UPDATE exports SET status = $1, error = $2, updated_at = $3, completed_at = $3 WHERE status IN ($4, $5) AND updated_at < $6", ExportFailed, "export was interrupted", now, ExportPending, ExportRunning, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetExpiredExports returns completed exports finished before the given time whose archive still exists
+func GetExpiredExports(before time.Time, limit int) ([]Export, error) {
+	rows, err := DBConnection.Query("SELECT "+exportColumns+" FROM exports WHERE status = $1 AND storage_key IS NOT NULL AND completed_at < $2 ORDER BY completed_at LIMIT $3", ExportCompleted, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	exports := []Export{}
+	for rows.Next() {
+		export, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+	return exports, rows.Err()
+}
+
+// ExpireExport records that the archive of the export was deleted
+func ExpireExport(exportId string) error {
+	_, err := DBConnection.Exec("UPDATE exports SET status = $1, storage_key = NULL, updated_at = $2 WHERE id = $3", ExportExpired, time.Now(), exportId)
+	return err
+}
+
+// GetAllImages returns every image of the user, oldest first
+func GetAllImages(userId string) ([]ImageSchema, error) {
+	rows, err := DBConnection.Query("SELECT "+imageColumns+" FROM images WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at, id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	images := []ImageSchema{}
+	for rows.Next() {
+		var image ImageSchema
+		err := rows.Scan(imageScanTargets(&image)...)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// UpdateImageMetadata applies the non-nil fields of the update.
+// When etag is not empty the update fails with ErrImageModified unless it matches the stored image.
+func UpdateImageMetadata(imageID string, userId string, etag string, update ImageMetadataUpdate) (ImageSchema, error) {
+	tx, err := DBConnection.Begin()
+	if err != nil {
+		return ImageSchema{}, err
+	}
+	defer tx.Rollback()
+	var image ImageSchema
+	err = tx.QueryRow("SELECT "+imageColumns+" FROM images WHERE image_id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE", imageID, userId).Scan(imageScanTargets(&image)...)
+	if err != nil {
+		return ImageSchema{}, err
+	}
+	if etag != "" && etag != imageETag(image) {
+		return image, ErrImageModified
+	}
+	if update.DisplayName != nil {
+		image.DisplayName = *update.DisplayName
+	}
+	if update.Description != nil {
+		image.Description = *update.Description
+	}
+	if update.Tags != nil {
+		image.Tags = *update.Tags
+	}
+	if update.Metadata != nil {
+		image.Metadata = *update.Metadata
+	}
+	image.UpdatedAt = time.Now()
+	err = tx.QueryRow("UPDATE images SET display_name = $1, description = $2, tags = $3, metadata = $4, updated_at = $5 WHERE image_id = $6 RETURNING updated_at", image.DisplayName, image.Description, pq.Array(image.Tags), image.Metadata, image.UpdatedAt, imageID).Scan(&image.UpdatedAt)
+	if err != nil {
+		return ImageSchema{}, err
+	}
+	return image, tx.Commit()
+}
+
+func CreateImageVersionsTable() error {
+	err := CreateTable(DBConnection, "image_versions", `
+		image_id TEXT NOT NULL,
+		version INT NOT NULL,
+		filename TEXT NOT NULL,
+		size INT NOT NULL,
+		format TEXT NOT NULL,
+		width INT NOT NULL,
+		height INT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (image_id, version)
+	`)
+	if err != nil {
+		return err
+	}
+	// Images uploaded before versioning get their original as version 1
+	_, err = DBConnection.Exec(`
+		INSERT INTO image_versions (image_id, version, filename, size, format, width, height, created_at)
+		SELECT image_id, 1, filename, size, format, width, height, created_at FROM images
+		ON CONFLICT DO NOTHING`)
+	return err
+}
+
+func insertImageVersion(tx *sql.Tx, version ImageVersion) error {
+	_, err := tx.Exec("INSERT INTO image_versions (image_id, version, filename, size, format, width, height, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT DO NOTHING", version.ImageID, version.Version, version.Filename, version.Size, version.Format, version.Width, version.Height, version.CreatedAt)
+	return err
+}
+
+// ReserveImageVersion hands out the next version number of an image, numbers of failed replacements are not reused
+func ReserveImageVersion(imageID string, userId string) (int, error) {
+	var version int
+	err := DBConnection.QueryRow("UPDATE images SET latest_version = latest_version + 1 WHERE image_id = $1 AND user_id = $2 AND deleted_at IS NULL RETURNING latest_version", imageID, userId).Scan(&version)
+	return version, err
+}
+
+func GetImageVersions(imageID string, userId string) ([]ImageVersion, error) {
+	rows, err := DBConnection.Query(`
+		SELECT v.image_id, v.version, v.filename, v.size, v.format, v.width, v.height, v.created_at, v.version = i.version
+		FROM image_versions v JOIN images i ON i.image_id = v.image_id
+		WHERE v.image_id = $1 AND i.user_id = $2 AND i.deleted_at IS NULL ORDER BY v.version DESC`, imageID, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := []ImageVersion{}
+	for rows.Next() {
+		var version ImageVersion
+		err = rows.Scan(&version.ImageID, &version.Version, &version.Filename, &version.Size, &version.Format, &version.Width, &version.Height, &version.CreatedAt, &version.Current)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+func GetImageVersion(imageID string, userId string, number int) (ImageVersion, error) {
+	var version ImageVersion
+	err := DBConnection.QueryRow(`
+		SELECT v.image_id, v.version, v.filename, v.size, v.format, v.width, v.height, v.created_at, v.version = i.version
+		FROM image_versions v JOIN images i ON i.image_id = v.image_id
+		WHERE v.image_id = $1 AND i.user_id = $2 AND i.deleted_at IS NULL AND v.version = $3`, imageID, userId, number).Scan(&version.ImageID, &version.Version, &version.Filename, &version.Size, &version.Format, &version.Width, &version.Height, &version.CreatedAt, &version.Current)
+	return version, err
+}
+
+// SetImageVersion makes the version the current one of the image and moves its job back in queue.
+// This is not a job transition: the content changed, so even completed images are processed again.
+// Images being processed are rejected with ErrImageProcessing.
+func SetImageVersion(userId string, version ImageVersion, reason string) (ImageSchema, error) {
+	tx, err := DBConnection.Begin()
+	if err != nil {
+		return ImageSchema{}, err
+	}
+	defer tx.Rollback()
+	var currentStatus string
+	err = tx.QueryRow("SELECT job_status FROM images WHERE image_id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE", version.ImageID, userId).Scan(&currentStatus)
+	if err != nil {
+		return ImageSchema{}, err
+	}
+	if JobStatus(currentStatus) == JobProcessing {
+		return ImageSchema{}, ErrImageProcessing
+	}
+	err = insertImageVersion(tx, version)
+	if err != nil {
+		return ImageSchema{}, err
+	}
+	now := time.Now()
+	var image ImageSchema
+	err = tx.QueryRow(`
+		UPDATE images SET filename = $1, size = $2, format = $3, width = $4, height = $5, version = $6,
+			job_status = $7, compressed_at = NULL, compressed_size = NULL, updated_at = $8
+		WHERE image_id = $9 RETURNING `+imageColumns, version.Filename, version.Size, version.Format, version.Width, version.Height, version.Version, JobInQueue, now, version.ImageID).Scan(imageScanTargets(&image)...)
+	if err != nil {
+		return ImageSchema{}, err
+	}
+	err = insertJobEvent(tx, JobEvent{
+		ImageID: version.ImageID,
+		FromStatus: sql.NullString{String: currentStatus, Valid: true},
+		ToStatus: string(JobInQueue),
+		Reason: sql.NullString{String: reason, Valid: true},
+		CreatedAt: now,
+	})
+	if err != nil {
+		return ImageSchema{}, err
+	}
+	return image, tx.Commit()
+}
+
+// TrashImage moves the image to the trash, returns sql.ErrNoRows when it does not exist or is already trashed
+func TrashImage(imageID string, userId string) (ImageSchema, error) {
+	var image ImageSchema
+	now := time.Now()
+	err := DBConnection.QueryRow("UPDATE images SET deleted_at = $1, updated_at = $1 WHERE image_id = $2 AND user_id = $3 AND deleted_at IS NULL RETURNING "+imageColumns, now, imageID, userId).Scan(imageScanTargets(&image)...)
+	return image, err
+}
+
+func RestoreImage(imageID string, userId string) (ImageSchema, error) {
+	var image ImageSchema
+	err := DBConnection.QueryRow("UPDATE images SET deleted_at = NULL, updated_at = $1 WHERE image_id = $2 AND user_id = $3 AND deleted_at IS NOT NULL RETURNING "+imageColumns, time.Now(), imageID, userId).Scan(imageScanTargets(&image)...)
+	return image, err
+}
+
+func GetTrashedImage(imageID string, userId string) (ImageSchema, error) {
+	var image ImageSchema
+	err := DBConnection.QueryRow("SELECT "+imageColumns+" FROM images WHERE image_id = $1 AND user_id = $2 AND deleted_at IS NOT NULL", imageID, userId).Scan(imageScanTargets(&image)...)
+	return image, err
+}
+
+// GetExpiredTrash returns images trashed before the given time, oldest first
+func GetExpiredTrash(before time.Time, limit int) ([]ImageSchema, error) {
+	rows, err := DBConnection.Query("SELECT "+imageColumns+" FROM images WHERE deleted_at < $1 ORDER BY deleted_at LIMIT $2", before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	images := []ImageSchema{}
+	for rows.Next() {
+		var image ImageSchema
+		err := rows.Scan(imageScanTargets(&image)...)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// DeleteImage permanently removes a trashed image, job events and album entries are removed by their foreign keys
+func DeleteImage(imageID string) error {
+	tx, err := DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("DELETE FROM images WHERE image_id = $1 AND deleted_at IS NOT NULL", imageID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// Restored in the meantime
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = tx.Exec("DELETE FROM image_versions WHERE image_id = $1", imageID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func CreateShareLinksTable() error {
+	err := CreateTable(DBConnection, "share_links", `
+		token TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		image_id TEXT REFERENCES images(image_id) ON DELETE CASCADE,
+		album_id TEXT REFERENCES albums(id) ON DELETE CASCADE,
+		variant TEXT NOT NULL,
+		password_hash TEXT,
+		expires_at TIMESTAMP,
+		max_views INT,
+		views INT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = DBConnection.Exec("CREATE INDEX IF NOT EXISTS share_links_user_id_idx ON share_links (user_id, created_at)")
+	if err != nil {
+		return err
+	}
+	for _, migration := range shareLinkMigrations {
+		_, err = DBConnection.Exec(migration)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shareLinkMigrations add the columns introduced after the share_links table was first created
+var shareLinkMigrations = []string{
+	"ALTER TABLE share_links ADD COLUMN IF NOT EXISTS password_failures INT NOT NULL DEFAULT 0",
+	"ALTER TABLE share_links ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP",
+}
+
+const shareLinkColumns = "token, user_id, image_id, album_id, variant, password_hash, expires_at, max_views, views, created_at, password_failures, locked_until"
+
+func scanShareLink(scanner interface{ Scan(...interface{}) error }) (ShareLink, error) {
+	var share ShareLink
+	err := scanner.Scan(&share.Token, &share.UserId, &share.ImageID, &share.AlbumID, &share.Variant, &share.PasswordHash, &share.ExpiresAt, &share.MaxViews, &share.Views, &share.CreatedAt, &share.PasswordFailures, &share.LockedUntil)
+	return share, err
+}
+
+func InsertShareLink(share ShareLink) error {
+	_, err := DBConnection.Exec("INSERT INTO share_links ("+shareLinkColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)", share.Token, share.UserId, share.ImageID, share.AlbumID, share.Variant, share.PasswordHash, share.ExpiresAt, share.MaxViews, share.Views, share.CreatedAt, share.PasswordFailures, share.LockedUntil)
+	return err
+}
+
+func GetShareLinks(userId string) ([]ShareLink, error) {
+	rows, err := DBConnection.Query("SELECT "+shareLinkColumns+" FROM share_links WHERE user_id = $1 ORDER BY created_at DESC", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shares := []ShareLink{}
+	for rows.Next() {
+		share, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func GetShareLink(token string) (ShareLink, error) {
+	return scanShareLink(DBConnection.QueryRow("SELECT "+shareLinkColumns+" FROM share_links WHERE token = $1", token))
+}
+
+// CountShareLinkView records a view, returns false when the link expired or ran out of views in the meantime
+func CountShareLinkView(token string) (bool, error) {
+	result, err := DBConnection.Exec("UPDATE share_links SET views = views + 1 WHERE token = $1 AND (max_views IS NULL OR views < max_views) AND (expires_at IS NULL OR expires_at > $2)", token, time.Now())
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// RecordSharePasswordFailure counts a wrong password, the maxFailures-th one in a row locks the link until lockedUntil
+func RecordSharePasswordFailure(token string, maxFailures int, lockedUntil time.Time) error {
+	_, err := DBConnection.Exec(`
+		UPDATE share_links SET
+			password_failures = CASE WHEN password_failures + 1 >= $1 THEN 0 ELSE password_failures + 1 END,
+			locked_until = CASE WHEN password_failures + 1 >= $1 THEN $2 ELSE locked_until END
+		WHERE token = $3`, maxFailures, lockedUntil, token)
+	return err
+}
+
+func ResetSharePasswordFailures(token string) error {
+	_, err := DBConnection.Exec("UPDATE share_links SET password_failures = 0 WHERE token = $1", token)
+	return err
+}
+
+func DeleteShareLink(token string, userId string) error {
+	result, err := DBConnection.Exec("DELETE FROM share_links WHERE token = $1 AND user_id = $2", token, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxProcessingDimension = 10000
+	maxTargetSize = 10 << 20
+)
+
+var outputFormats = []string{"jpeg", "png", "webp"}
+
+// ProcessingOptions are the uploader's compression settings, zero values let the executor use its defaults
+type ProcessingOptions struct {
+	Quality int `json:"quality,omitempty"`
+	MaxWidth int `json:"max_width,omitempty"`
+	MaxHeight int `json:"max_height,omitempty"`
+	OutputFormat string `json:"output_format,omitempty"`
+	// Target size of the compressed image in bytes
+	TargetSize int `json:"target_size,omitempty"`
+	StripMetadata bool `json:"strip_metadata,omitempty"`
+}
+
+// Value stores the options in the processing_options JSONB column
+func (o ProcessingOptions) Value() (driver.Value, error) {
+	return jsonStringify(o)
+}
+
+func (o *ProcessingOptions) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*o = ProcessingOptions{}
+		return nil
+	case []byte:
+		return json.Unmarshal(value, o)
+	case string:
+		return json.Unmarshal([]byte(value), o)
+	}
+	return fmt.Errorf("unsupported processing options type %T", src)
+}
+
+// parseProcessingOptions reads and validates the processing options form fields of an upload
+func parseProcessingOptions(r *http.Request) (ProcessingOptions, error) {
+	options := ProcessingOptions{}
+	var err error
+	options.Quality, err = parseIntFormValue(r, "quality", 1, 100)
+	if err != nil {
+		return options, err
+	}
+	options.MaxWidth, err = parseIntFormValue(r, "max_width", 1, maxProcessingDimension)
+	if err != nil {
+		return options, err
+	}
+	options.MaxHeight, err = parseIntFormValue(r, "max_height", 1, maxProcessingDimension)
+	if err != nil {
+		return options, err
+	}
+	options.TargetSize, err = parseIntFormValue(r, "target_size", 1, maxTargetSize)
+	if err != nil {
+		return options, err
+	}
+	outputFormat := strings.ToLower(strings.TrimSpace(r.FormValue("output_format")))
+	if outputFormat == "jpg" {
+		outputFormat = "jpeg"
+	}
+	if outputFormat != "" && !isOutputFormat(outputFormat) {
+		return options, errors.New("output_format must be one of jpeg, png or webp")
+	}
+	options.OutputFormat = outputFormat
+	if stripMetadata := r.FormValue("strip_metadata"); stripMetadata != "" {
+		options.StripMetadata, err = strconv.ParseBool(stripMetadata)
+		if err != nil {
+			return options, errors.New("strip_metadata must be a boolean")
+		}
+	}
+	return options, nil
+}
+
+// parseIntFormValue returns 0 for a missing field, otherwise the value if it lies within min and max
+func parseIntFormValue(r *http.Request, field string, min int, max int) (int, error) {
+	rawValue := strings.TrimSpace(r.FormValue(field))
+	if rawValue == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(rawValue)
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("%s must be a number between %d and %d", field, min, max)
+	}
+	return value, nil
+}
+
+func isOutputFormat(format string) bool {
+	for _, outputFormat := range outputFormats {
+		if outputFormat == format {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ktbsomen/gobullmq"
+	"github.com/ktbsomen/gobullmq/types"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -13,56 +16,329 @@ type Message struct {
 	Pattern string `json:"pattern"`
 	Message string `json:"message"`
 	MessageId string `json:"message_id"`
+	// Queue to add the job to, the default queue when empty
+	QueueName string `json:"-"`
+	// Overrides the publisher's default job options when set
+	JobOptions *JobOptions `json:"-"`
+	// Time to wait before the job can be processed, 0 to process it as soon as possible
+	Delay time.Duration `json:"-"`
+}
+
+type JobOptions struct {
+	// Total number of attempts including the first one
+	Attempts int
+	// Base delay in milliseconds of the exponential backoff between attempts
+	BackoffDelay int
+	// Maximum processing time in milliseconds, 0 means no timeout
+	Timeout int
+	// Lower numbers are processed first, 0 means no priority
+	Priority int
 }
 
 type Options struct {
 	QueueName string
+	DefaultJobOptions JobOptions
+	// Maps user tiers to the queue and base priority of their jobs, tiers without a route use QueueName
+	Routes map[UserTier]QueueRoute
+	Fairness FairnessOptions
+}
+
+// JobInfo is the broker's view of a job, an empty Id means the broker does not know the job
+type JobInfo struct {
+	Id string
+	AttemptsMade int
+	FailedReason string
+	// True once the job completed or failed for good
+	Finished bool
+}
+
+// Publisher enqueues processing jobs and controls them once enqueued.
+// RedisPublisher is the default, MemoryBroker runs without Redis.
+type Publisher interface {
+	Publish(message Message) error
+	GetJob(jobId string) (JobInfo, error)
+	// RemoveJob deletes a job that is not being processed, missing jobs are ignored
+	RemoveJob(jobId string) error
+	// CancelJob removes the job if no worker has started it yet, started is true when it could not be removed
+	CancelJob(jobId string) (started bool, err error)
+	// PublishCancellation signals the worker processing the image to stop
+	PublishCancellation(imageID string, userId string) error
+	// ClearCancellation forgets a published cancellation before the image gets a new job
+	ClearCancellation(imageID string) error
+	Ping() error
+	Close() error
+}
+
+const (
+	// Channel and key prefix the executor observes to stop processing a cancelled image
+	cancellationChannel = "image-processor-cancel"
+	cancellationTTL = 24 * time.Hour
+)
+
+var publisher Publisher = nil
+var publisherOptions Options
+
+func InitializePublisher(p Publisher, options Options) {
+	publisher = p
+	publisherOptions = options
+	fmt.Println("Publisher initialized successfully")
 }
 
-var messageQueue *gobullmq.Queue = nil
-var redisClient *redis.Client = nil
+func ClosePublisher() {
+	if publisher != nil {
+		publisher.Close()
+		publisher = nil
+	}
+}
+
+func PublishMessage(message Message) error {
+	if publisher == nil {
+		return errors.New("publisher not initialized")
+	}
+	return publisher.Publish(message)
+}
+
+// GetJob returns the queued job with the given ID, or a job with an empty Id when it does not exist
+func GetJob(jobId string) (JobInfo, error) {
+	if publisher == nil {
+		return JobInfo{}, errors.New("publisher not initialized")
+	}
+	return publisher.GetJob(jobId)
+}
 
-func InitializePublisher(redisUrl string,options Options) error {
+func RemoveJob(jobId string) error {
+	if publisher == nil {
+		return errors.New("publisher not initialized")
+	}
+	return publisher.RemoveJob(jobId)
+}
+
+func CancelJob(jobId string) (bool, error) {
+	if publisher == nil {
+		return false, errors.New("publisher not initialized")
+	}
+	return publisher.CancelJob(jobId)
+}
+
+func PublishCancellation(imageID string, userId string) error {
+	if publisher == nil {
+		return errors.New("publisher not initialized")
+	}
+	return publisher.PublishCancellation(imageID, userId)
+}
+
+func ClearCancellation(imageID string) error {
+	if publisher == nil {
+		return errors.New("publisher not initialized")
+	}
+	return publisher.ClearCancellation(imageID)
+}
+
+func PingPublisher() error {
+	if publisher == nil {
+		return errors.New("publisher not initialized")
+	}
+	return publisher.Ping()
+}
+
+// RedisPublisher adds jobs to gobullmq queues consumed by the external job executor
+type RedisPublisher struct {
+	client *redis.Client
+	// Default queue, used when a message has no queue name
+	queue *gobullmq.Queue
+	// All queues jobs can be routed to by name, including the default queue
+	queues map[string]*gobullmq.Queue
+	// Built-in workers, only started by ConsumeJobs
+	workers []*gobullmq.Worker
+}
+
+func NewRedisPublisher(redisUrl string, options Options) (*RedisPublisher, error) {
 	opt, err := redis.ParseURL(redisUrl)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	redis := redis.NewClient(opt)
-	redisClient = redis
 	pong, err := redis.Ping(context.Background()).Result()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	fmt.Println("Redis connected successfully", pong)
 	context := context.Background()
 
 	queue ,err:= gobullmq.NewQueue(context, options.QueueName, redis);
 	if err != nil {
+		return nil, err
+	}
+	p := &RedisPublisher{
+		client: redis,
+		queue: queue,
+		queues: map[string]*gobullmq.Queue{options.QueueName: queue},
+	}
+	for tier, route := range options.Routes {
+		if p.queues[route.QueueName] != nil {
+			continue
+		}
+		routeQueue, err := gobullmq.NewQueue(context, route.QueueName, redis)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create queue %s for tier %s: %w", route.QueueName, tier, err)
+		}
+		p.queues[route.QueueName] = routeQueue
+	}
+	return p, nil
+}
+
+func (p *RedisPublisher) Publish(message Message) error {
+	jobOptions := publisherOptions.DefaultJobOptions
+	if message.JobOptions != nil {
+		jobOptions = *message.JobOptions
+	}
+	addOptions := []gobullmq.AddOption{
+		gobullmq.AddWithAttempts(jobOptions.Attempts),
+		gobullmq.AddWithPriority(jobOptions.Priority),
+		gobullmq.AddWithBackoff("exponential", jobOptions.BackoffDelay),
+		gobullmq.AddWithTimeout(jobOptions.Timeout),
+	}
+	if message.MessageId != "" {
+		addOptions = append(addOptions, gobullmq.AddWithJobID(message.MessageId))
+	}
+	if message.Delay > 0 {
+		addOptions = append(addOptions, gobullmq.AddWithDelay(int(message.Delay.Milliseconds())))
+	}
+	queue := p.queue
+	if message.QueueName != "" {
+		queue = p.queues[message.QueueName]
+		if queue == nil {
+			return fmt.Errorf("unknown queue %s", message.QueueName)
+		}
+	}
+	_, err := queue.Add(context.Background(), message.Pattern, message, addOptions...)
+	return err
+}
+
+// findJobQueue returns the queue holding the job, or nil when no queue has it
+func (p *RedisPublisher) findJobQueue(jobId string) (*gobullmq.Queue, error) {
+	for _, queue := range p.queues {
+		exists, err := p.client.Exists(context.Background(), queue.KeyPrefix+jobId).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists > 0 {
+			return queue, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *RedisPublisher) GetJob(jobId string) (JobInfo, error) {
+	queue, err := p.findJobQueue(jobId)
+	if err != nil || queue == nil {
+		return JobInfo{}, err
+	}
+	job, err := gobullmq.JobFromId(context.Background(), p.client, queue.KeyPrefix, jobId)
+	if err != nil {
+		return JobInfo{}, err
+	}
+	return JobInfo{Id: job.Id, AttemptsMade: job.AttemptsMade, FailedReason: job.FailedReason, Finished: !job.FinishedOn.IsZero()}, nil
+}
+
+func (p *RedisPublisher) RemoveJob(jobId string) error {
+	queue, err := p.findJobQueue(jobId)
+	if err != nil || queue == nil {
 		return err
 	}
-	messageQueue = queue
-	fmt.Println("Publisher initialized successfully")
-	return nil
+	return queue.Remove(jobId, false)
 }
 
-func PublishMessage(message Message) error {
-	if messageQueue == nil {
-		return errors.New("publisher not initialized")
+func (p *RedisPublisher) CancelJob(jobId string) (bool, error) {
+	queue, err := p.findJobQueue(jobId)
+	if err != nil || queue == nil {
+		return false, err
 	}
-	_,err := messageQueue.Add(context.Background(), message.Pattern,message)
+	err = queue.Remove(jobId, false)
+	if err == nil {
+		return false, nil
+	}
+	// Workers hold a lock on the jobs they process, which makes Remove fail
+	locked, lockErr := p.client.Exists(context.Background(), queue.KeyPrefix+jobId+":lock").Result()
+	if lockErr == nil && locked > 0 {
+		return true, nil
+	}
+	return false, err
+}
+
+// PublishCancellation is published for running executors and also kept as a key for executors that poll before each step
+func (p *RedisPublisher) PublishCancellation(imageID string, userId string) error {
+	payload, err := jsonStringify(ImageProcessorMessage{ImageID: imageID, UserId: userId})
 	if err != nil {
 		return err
 	}
-	return nil
+	ctx := context.Background()
+	err = p.client.Set(ctx, cancellationChannel+":"+imageID, payload, cancellationTTL).Err()
+	if err != nil {
+		return err
+	}
+	return p.client.Publish(ctx, cancellationChannel, payload).Err()
 }
 
-func PingPublisher() error {
-	if messageQueue == nil {
-		return errors.New("publisher not initialized")
+// ClearCancellation deletes the key left by PublishCancellation, executors would otherwise skip the image's next job
+func (p *RedisPublisher) ClearCancellation(imageID string) error {
+	return p.client.Del(context.Background(), cancellationChannel+":"+imageID).Err()
+}
+
+// IsCancelled checks the key left by PublishCancellation
+func (p *RedisPublisher) IsCancelled(imageID string) bool {
+	exists, err := p.client.Exists(context.Background(), cancellationChannel+":"+imageID).Result()
+	return err == nil && exists > 0
+}
+
+// ConsumeJobs starts a gobullmq worker on every queue, taking the place of the external job executor
+func (p *RedisPublisher) ConsumeJobs(concurrency int, process JobProcessor) error {
+	workerOptions := gobullmq.WorkerOptions{
+		Concurrency: concurrency,
+		StalledInterval: 30000,
+		MaxStalledCount: 1,
+		LockDuration: 30000,
+		LockRenewTime: 15000,
+		DrainDelay: 5,
+		RunRetryDelay: 1000,
+	}
+	if backoffDelay := publisherOptions.DefaultJobOptions.BackoffDelay; backoffDelay > 0 {
+		workerOptions.Backoff = &gobullmq.BackoffOptions{Type: "exponential", Delay: backoffDelay}
 	}
-	_,err := redisClient.Ping(context.Background()).Result()
+	for name := range p.queues {
+		worker, err := gobullmq.NewWorker(context.Background(), name, workerOptions, p.client, func(ctx context.Context, job *types.Job, api gobullmq.WorkerProcessAPI) (interface{}, error) {
+			var message Message
+			rawData, _ := job.Data.(string)
+			err := json.Unmarshal([]byte(rawData), &message)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse job data: %w", err)
+			}
+			finalAttempt := job.AttemptsMade+1 >= job.Opts.Attempts
+			return nil, process(ctx, message, finalAttempt)
+		})
+		if err != nil {
+			return err
+		}
+		err = worker.Run()
+		if err != nil {
+			return err
+		}
+		p.workers = append(p.workers, worker)
+	}
+	return nil
+}
+
+func (p *RedisPublisher) Ping() error {
+	_,err := p.client.Ping(context.Background()).Result()
 	if err != nil {
 		return err
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+func (p *RedisPublisher) Close() error {
+	for _, worker := range p.workers {
+		worker.Close()
+	}
+	return p.client.Close()
+}
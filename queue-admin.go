@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ktbsomen/gobullmq"
+	"github.com/ktbsomen/gobullmq/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// Job states as named by the BullMQ keys holding them
+var queueJobStates = []string{"wait", "paused", "prioritized", "active", "delayed", "completed", "failed"}
+
+// queueCountsScript counts jobs per state without the "0:" markers BullMQ keeps in wait lists to wake up workers
+var queueCountsScript = redis.NewScript(`
+local results = {}
+for i = 1, #ARGV do
+  local key = KEYS[1] .. ARGV[i]
+  if ARGV[i] == "wait" or ARGV[i] == "paused" or ARGV[i] == "active" then
+    local count = redis.call("LLEN", key)
+    for _, index in ipairs({0, -1}) do
+      local head = redis.call("LINDEX", key, index)
+      if head and string.sub(head, 1, 2) == "0:" and count > 0 then
+        count = count - 1
+      end
+    end
+    results[#results+1] = count
+  else
+    results[#results+1] = redis.call("ZCARD", key)
+  end
+end
+return results
+`)
+
+// queuePromoteScript moves a delayed job to the wait list, mirroring BullMQ's promote script
+var queuePromoteScript = redis.NewScript(`
+local jobId = ARGV[2]
+if redis.call("ZREM", KEYS[1], jobId) ~= 1 then
+  return -3
+end
+local jobKey = ARGV[1] .. jobId
+local priority = tonumber(redis.call("HGET", jobKey, "priority")) or 0
+local target = KEYS[2]
+local paused = redis.call("HEXISTS", KEYS[4], "paused") == 1
+if paused then
+  target = KEYS[3]
+end
+local marker = redis.call("LINDEX", target, 0)
+if marker and string.sub(marker, 1, 2) == "0:" then
+  redis.call("LPOP", target)
+end
+if priority == 0 then
+  redis.call("LPUSH", target, jobId)
+else
+  local counter = redis.call("INCR", KEYS[6])
+  redis.call("ZADD", KEYS[5], priority * 0x100000000 + bit.band(counter, 0xffffffffffff), jobId)
+  if not paused and redis.call("LLEN", KEYS[2]) == 0 then
+    redis.call("LPUSH", KEYS[2], "0:0")
+  end
+end
+redis.call("XADD", KEYS[7], "*", "event", "waiting", "jobId", jobId, "prev", "delayed")
+redis.call("HSET", jobKey, "delay", 0)
+return 0
+`)
+
+type QueueSummary struct {
+	Name string `json:"name"`
+	Paused bool `json:"paused"`
+	Counts map[string]int64 `json:"counts"`
+}
+
+type QueueJob struct {
+	Id string `json:"id"`
+	Name string `json:"name"`
+	Data interface{} `json:"data"`
+	Opts types.JobOptions `json:"opts"`
+	Progress int `json:"progress"`
+	AttemptsMade int `json:"attempts_made"`
+	FailedReason string `json:"failed_reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ProcessedOn *time.Time `json:"processed_on,omitempty"`
+	FinishedOn *time.Time `json:"finished_on,omitempty"`
+}
+
+type QueueJobsResponse struct {
+	Jobs []QueueJob `json:"jobs"`
+	TotalCount int64 `json:"count"`
+}
+
+type PromoteResponse struct {
+	Promoted int `json:"promoted"`
+}
+
+// requireAdminToken protects admin routes with the ADMIN_TOKEN bearer token, they are disabled when it is unset
+func requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminToken := os.Getenv("ADMIN_TOKEN")
+		if adminToken == "" {
+			returnAppError(w, "Admin API is disabled", http.StatusForbidden, nil)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			returnAppError(w, "Invalid admin token", http.StatusUnauthorized, nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *RedisPublisher) GetQueueCounts(queue *gobullmq.Queue) (map[string]int64, error) {
+	args := make([]interface{}, len(queueJobStates))
+	for i, state := range queueJobStates {
+		args[i] = state
+	}
+	results, err := queueCountsScript.Run(context.Background(), p.client, []string{queue.KeyPrefix}, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{}
+	for i, state := range queueJobStates {
+		counts[state] = results[i]
+	}
+	// BullMQ reports prioritized jobs as waiting
+	counts["waiting"] = counts["wait"] + counts["prioritized"]
+	delete(counts, "wait")
+	return counts, nil
+}
+
+// ListQueueJobs returns jobs in the given state, most recent first for finished states
+func (p *RedisPublisher) ListQueueJobs(queue *gobullmq.Queue, state string, skip int64, limit int64) ([]QueueJob, int64, error) {
+	ctx := context.Background()
+	key := queue.KeyPrefix + state
+	var ids []string
+	var total int64
+	var err error
+	switch state {
+	case "wait", "paused", "active":
+		ids, err = p.client.LRange(ctx, key, skip, skip+limit-1).Result()
+		if err == nil {
+			total, err = p.client.LLen(ctx, key).Result()
+		}
+	case "completed", "failed":
+		ids, err = p.client.ZRevRange(ctx, key, skip, skip+limit-1).Result()
+		if err == nil {
+			total, err = p.client.ZCard(ctx, key).Result()
+		}
+	case "delayed", "prioritized":
+		ids, err = p.client.ZRange(ctx, key, skip, skip+limit-1).Result()
+		if err == nil {
+			total, err = p.client.ZCard(ctx, key).Result()
+		}
+	default:
+		return nil, 0, errors.New("unknown job state " + state)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	jobs := []QueueJob{}
+	for _, id := range ids {
+		if strings.HasPrefix(id, "0:") {
+			continue
+		}
+		job, err := gobullmq.JobFromId(ctx, p.client, queue.KeyPrefix, id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if job.Id == "" {
+			continue
+		}
+		jobs = append(jobs, toQueueJob(job))
+	}
+	return jobs, total, nil
+}
+
+func toQueueJob(job types.Job) QueueJob {
+	queueJob := QueueJob{
+		Id: job.Id,
+		Name: job.Name,
+		Data: job.Data,
+		Opts: job.Opts,
+		Progress: job.Progress,
+		AttemptsMade: job.AttemptsMade,
+		FailedReason: job.FailedReason,
+		CreatedAt: time.UnixMilli(job.TimeStamp),
+	}
+	// Job data is stored as a JSON string, decode it so payloads are readable
+	if rawData, ok := job.Data.(string); ok {
+		var data interface{}
+		if json.Unmarshal([]byte(rawData), &data) == nil {
+			queueJob.Data = data
+		}
+	}
+	if !job.ProcessedOn.IsZero() {
+		queueJob.ProcessedOn = &job.ProcessedOn
+	}
+	if !job.FinishedOn.IsZero() {
+		queueJob.FinishedOn = &job.FinishedOn
+	}
+	return queueJob
+}
+
+// PauseQueue stops workers from taking new jobs
+func (p *RedisPublisher) PauseQueue(queue *gobullmq.Queue) error {
+	ctx := context.Background()
+	exists, err := p.client.Exists(ctx, queue.KeyPrefix+"wait").Result()
+	if err != nil {
+		return err
+	}
+	// gobullmq refuses to pause an empty queue, flagging it is enough when there is nothing to move
+	if exists == 0 {
+		return p.client.HSet(ctx, queue.KeyPrefix+"meta", "paused", 1).Err()
+	}
+	return queue.Pause(ctx)
+}
+
+func (p *RedisPublisher) ResumeQueue(queue *gobullmq.Queue) error {
+	ctx := context.Background()
+	exists, err := p.client.Exists(ctx, queue.KeyPrefix+"paused").Result()
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return p.client.HDel(ctx, queue.KeyPrefix+"meta", "paused").Err()
+	}
+	return queue.Resume(ctx)
+}
+
+// QueuedImageJobs returns the jobs a drain removes: waiting, paused and prioritized ones, and delayed ones with delayed
+func (p *RedisPublisher) QueuedImageJobs(queue *gobullmq.Queue, delayed bool) ([]ImageProcessorMessage, error) {
+	ctx := context.Background()
+	ids := []string{}
+	for _, state := range []string{"wait", "paused"} {
+		stateIds, err := p.client.LRange(ctx, queue.KeyPrefix+state, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, stateIds...)
+	}
+	zsetStates := []string{"prioritized"}
+	if delayed {
+		zsetStates = append(zsetStates, "delayed")
+	}
+	for _, state := range zsetStates {
+		stateIds, err := p.client.ZRange(ctx, queue.KeyPrefix+state, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, stateIds...)
+	}
+	jobs := []ImageProcessorMessage{}
+	for _, id := range ids {
+		if strings.HasPrefix(id, "0:") {
+			continue
+		}
+		rawData, err := p.client.HGet(ctx, queue.KeyPrefix+id, "data").Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var message Message
+		var job ImageProcessorMessage
+		if json.Unmarshal([]byte(rawData), &message) != nil || json.Unmarshal([]byte(message.Message), &job) != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// PromoteDelayedJobs moves delayed jobs to waiting, all of them when jobId is empty
+func (p *RedisPublisher) PromoteDelayedJobs(queue *gobullmq.Queue, jobId string) (int, error) {
+	ctx := context.Background()
+	ids := []string{jobId}
+	if jobId == "" {
+		var err error
+		ids, err = p.client.ZRange(ctx, queue.KeyPrefix+"delayed", 0, -1).Result()
+		if err != nil {
+			return 0, err
+		}
+	}
+	keys := []string{
+		queue.KeyPrefix + "delayed",
+		queue.KeyPrefix + "wait",
+		queue.KeyPrefix + "paused",
+		queue.KeyPrefix + "meta",
+		queue.KeyPrefix + "prioritized",
+		queue.KeyPrefix + "pc",
+		queue.KeyPrefix + "events",
+	}
+	promoted := 0
+	for _, id := range ids {
+		result, err := queuePromoteScript.Run(ctx, p.client, keys, queue.KeyPrefix, id).Int()
+		if err != nil {
+			return promoted, err
+		}
+		if result == 0 {
+			promoted++
+		}
+	}
+	return promoted, nil
+}
+
+// getRedisPublisher returns the publisher when it is backed by Redis, queue administration is not available otherwise
+func getRedisPublisher(w http.ResponseWriter) *RedisPublisher {
+	redisPublisher, ok := publisher.(*RedisPublisher)
+	if !ok {
+		returnAppError(w, "Queue administration is not supported by the configured broker", http.StatusNotImplemented, nil)
+		return nil
+	}
+	return redisPublisher
+}
+
+func getQueueFromRequest(w http.ResponseWriter, r *http.Request) (*RedisPublisher, *gobullmq.Queue) {
+	redisPublisher := getRedisPublisher(w)
+	if redisPublisher == nil {
+		return nil, nil
+	}
+	queueName := mux.Vars(r)["queue_name"]
+	queue := redisPublisher.queues[queueName]
+	if queue == nil {
+		returnAppError(w, "Queue not found", http.StatusNotFound, nil)
+		return nil, nil
+	}
+	return redisPublisher, queue
+}
+
+func listQueues(w http.ResponseWriter, r *http.Request) {
+	redisPublisher := getRedisPublisher(w)
+	if redisPublisher == nil {
+		return
+	}
+	names := make([]string, 0, len(redisPublisher.queues))
+	for name := range redisPublisher.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	summaries := []QueueSummary{}
+	for _, name := range names {
+		queue := redisPublisher.queues[name]
+		counts, err := redisPublisher.GetQueueCounts(queue)
+		if err != nil {
+			returnAppError(w, "Unable to count jobs", http.StatusInternalServerError, err)
+			return
+		}
+		paused, err := queue.IsPaused(context.Background())
+		if err != nil {
+			returnAppError(w, "Unable to get queue state", http.StatusInternalServerError, err)
+			return
+		}
+		summaries = append(summaries, QueueSummary{Name: name, Paused: paused, Counts: counts})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+func listQueueJobs(w http.ResponseWriter, r *http.Request) {
+	redisPublisher, queue := getQueueFromRequest(w, r)
+	if queue == nil {
+		return
+	}
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = "failed"
+	}
+	skip, err := strconv.ParseInt(r.URL.Query().Get("skip"), 10, 64)
+	if err != nil || skip < 0 {
+		skip = 0
+	}
+	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	jobs, total, err := redisPublisher.ListQueueJobs(queue, state, skip, limit)
+	if err != nil {
+		returnAppError(w, "Unable to list jobs", http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(QueueJobsResponse{Jobs: jobs, TotalCount: total})
+}
+
+func pauseQueue(w http.ResponseWriter, r *http.Request) {
+	redisPublisher, queue := getQueueFromRequest(w, r)
+	if queue == nil {
+		return
+	}
+	err := redisPublisher.PauseQueue(queue)
+	if err != nil {
+		returnAppError(w, "Unable to pause queue", http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func resumeQueue(w http.ResponseWriter, r *http.Request) {
+	redisPublisher, queue := getQueueFromRequest(w, r)
+	if queue == nil {
+		return
+	}
+	err := redisPublisher.ResumeQueue(queue)
+	if err != nil {
+		returnAppError(w, "Unable to resume queue", http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// drainQueue removes waiting jobs, and delayed ones with ?delayed=true, and cancels their images
+func drainQueue(w http.ResponseWriter, r *http.Request) {
+	redisPublisher, queue := getQueueFromRequest(w, r)
+	if queue == nil {
+		return
+	}
+	delayed, _ := strconv.ParseBool(r.URL.Query().Get("delayed"))
+	jobs, err := redisPublisher.QueuedImageJobs(queue, delayed)
+	if err != nil {
+		returnAppError(w, "Unable to list queued jobs", http.StatusInternalServerError, err)
+		return
+	}
+	err = queue.Drain(delayed)
+	if err != nil {
+		returnAppError(w, "Unable to drain queue", http.StatusInternalServerError, err)
+		return
+	}
+	cancelDrainedImages(jobs)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cancelDrainedImages moves the images of drained jobs to cancelled, the reconciler would otherwise enqueue them again.
+// Jobs a worker picked up before the drain are still in the queue, their images are left alone.
+func cancelDrainedImages(jobs []ImageProcessorMessage) {
+	for _, job := range jobs {
+		info, err := GetJob(job.ImageID)
+		if err != nil {
+			logStructured(ERROR, "Unable to check drained job for image: "+job.ImageID, err, 0, false)
+			continue
+		}
+		if info.Id != "" {
+			continue
+		}
+		err = TransitionJobStatus(JobTransition{ImageID: job.ImageID, UserId: job.UserId, Status: JobCancelled, Reason: "queue drained by an admin"})
+		if errors.Is(err, ErrIllegalJobTransition) || errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			logStructured(ERROR, "Unable to cancel drained image: "+job.ImageID, err, 0, false)
+			continue
+		}
+		NotifyProgress(ImageProcessorProgressMessage{
+			ImageID: job.ImageID,
+			UserId: job.UserId,
+			// The job holds the version's object name, clients know the image by its filename
+			Filename: path.Base(job.Filename),
+			Status: string(JobCancelled),
+		})
+	}
+}
+
+// promoteQueueJobs promotes every delayed job, or only the one given by ?job_id=
+func promoteQueueJobs(w http.ResponseWriter, r *http.Request) {
+	redisPublisher, queue := getQueueFromRequest(w, r)
+	if queue == nil {
+		return
+	}
+	promoted, err := redisPublisher.PromoteDelayedJobs(queue, r.URL.Query().Get("job_id"))
+	if err != nil {
+		returnAppError(w, "Unable to promote jobs", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PromoteResponse{Promoted: promoted})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type ReconcilerOptions struct {
+	Interval time.Duration
+	// Unfinished images not updated for this long are checked against the queue
+	StuckAfter time.Duration
+	// Maximum number of images checked per run
+	BatchSize int
+}
+
+// ReconcilerStats counts what the reconciler fixed since the process started
+type ReconcilerStats struct {
+	Runs int `json:"runs"`
+	Checked int `json:"checked"`
+	// Stuck images whose job is still waiting or running in the queue
+	InFlight int `json:"in_flight"`
+	Requeued int `json:"requeued"`
+	MarkedCompleted int `json:"marked_completed"`
+	MarkedFailed int `json:"marked_failed"`
+	Errors int `json:"errors"`
+	LastRunAt time.Time `json:"last_run_at"`
+}
+
+type reconcileAction int
+
+const (
+	reconcileInFlight reconcileAction = iota
+	reconcileRequeued
+	reconcileCompleted
+	reconcileFailed
+	// The image changed after it was selected, nothing to do
+	reconcileSkipped
+)
+
+var (
+	reconcilerMutex sync.Mutex
+	reconcilerStats ReconcilerStats
+)
+
+// StartReconciler periodically repairs images left in-queue or processing,
+// for example when the executor crashed or publishing the job failed.
+func StartReconciler(options ReconcilerOptions) {
+	fmt.Println("Reconciler started, checking images stuck for", options.StuckAfter)
+	go func() {
+		ticker := time.NewTicker(options.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			reconcileStuckJobs(options)
+		}
+	}()
+}
+
+func reconcileStuckJobs(options ReconcilerOptions) {
+	staleBefore := time.Now().Add(-options.StuckAfter)
+	images, err := GetStaleImages(staleBefore, options.BatchSize)
+	if err != nil {
+		logStructured(ERROR, "Unable to load stuck images", err, 0, false)
+		recordReconcileRun(ReconcilerStats{Errors: 1})
+		return
+	}
+	run := ReconcilerStats{Checked: len(images)}
+	for _, image := range images {
+		action, err := reconcileImage(image, staleBefore)
+		if err != nil {
+			logStructured(ERROR, "Unable to reconcile image: "+image.ImageID, err, 0, false)
+			run.Errors++
+			continue
+		}
+		switch action {
+		case reconcileInFlight:
+			run.InFlight++
+		case reconcileRequeued:
+			run.Requeued++
+		case reconcileCompleted:
+			run.MarkedCompleted++
+		case reconcileFailed:
+			run.MarkedFailed++
+		}
+	}
+	recordReconcileRun(run)
+	if run.Requeued+run.MarkedCompleted+run.MarkedFailed+run.Errors > 0 {
+		logStructured(INFO, fmt.Sprintf("Reconciled stuck images: checked=%d in_flight=%d requeued=%d marked_completed=%d marked_failed=%d errors=%d", run.Checked, run.InFlight, run.Requeued, run.MarkedCompleted, run.MarkedFailed, run.Errors), nil, 0, false)
+	}
+}
+
+// reconcileImage compares the image with its queue job, which uses the image ID as job ID
+func reconcileImage(image ImageSchema, staleBefore time.Time) (reconcileAction, error) {
+	job, err := GetJob(image.ImageID)
+	if err != nil {
+		return reconcileSkipped, err
+	}
+	transition := JobTransition{ImageID: image.ImageID, UserId: image.UserId, UnchangedSince: staleBefore}
+	action := reconcileSkipped
+	switch {
+	case job.Id == "" && JobStatus(image.JOB_STATUS) == JobInQueue:
+		transition.Status = JobInQueue
+		transition.Reason = "re-enqueued, no queue job was found"
+		action = reconcileRequeued
+	case job.Id == "":
+		transition.Status = JobFailed
+		transition.Reason = "queue job was lost while processing"
+		action = reconcileFailed
+	case job.Finished && job.FailedReason != "":
+		transition.Status = JobFailed
+		transition.Reason = "queue job failed: " + job.FailedReason
+		action = reconcileFailed
+	case job.Finished:
+		transition.Status = JobCompleted
+		transition.Progress = 100
+		transition.Reason = "queue job completed without a progress event"
+		action = reconcileCompleted
+	default:
+		return reconcileInFlight, nil
+	}
+
+	err = TransitionJobStatus(transition)
+	if errors.Is(err, ErrJobChanged) || errors.Is(err, ErrIllegalJobTransition) {
+		return reconcileSkipped, nil
+	}
+	if err != nil {
+		return reconcileSkipped, err
+	}
+	if action == reconcileRequeued {
+		return action, enqueueImageJob(image.ImageID, image.UserId, imageObjectName(image.Filename, image.Version), image.ProcessingOptions, image.ScheduledAt)
+	}
+	NotifyProgress(ImageProcessorProgressMessage{
+		ImageID: image.ImageID,
+		UserId: image.UserId,
+		Filename: image.Filename,
+		Progress: transition.Progress,
+		Status: string(transition.Status),
+	})
+	return action, nil
+}
+
+func recordReconcileRun(run ReconcilerStats) {
+	reconcilerMutex.Lock()
+	defer reconcilerMutex.Unlock()
+	reconcilerStats.Runs++
+	reconcilerStats.Checked += run.Checked
+	reconcilerStats.InFlight += run.InFlight
+	reconcilerStats.Requeued += run.Requeued
+	reconcilerStats.MarkedCompleted += run.MarkedCompleted
+	reconcilerStats.MarkedFailed += run.MarkedFailed
+	reconcilerStats.Errors += run.Errors
+	reconcilerStats.LastRunAt = time.Now()
+}
+
+func getReconcilerStats(w http.ResponseWriter, r *http.Request) {
+	reconcilerMutex.Lock()
+	stats := reconcilerStats
+	reconcilerMutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type UserTier string
+
+const (
+	TierPremium UserTier = "premium"
+	TierStandard UserTier = "standard"
+	TierBulk UserTier = "bulk"
+)
+
+var userTiers = []UserTier{TierPremium, TierStandard, TierBulk}
+
+type QueueRoute struct {
+	QueueName string
+	// Base BullMQ priority of the tier's jobs, lower is processed first
+	Priority int
+}
+
+// FairnessOptions lowers the priority of users with many unfinished jobs so large batches cannot starve single uploads
+type FairnessOptions struct {
+	// Number of unfinished jobs of a user that add one to the priority of their next job, 0 disables fairness
+	Step int
+	// Upper bound of the priority added by fairness
+	MaxPenalty int
+}
+
+type UserTierBody struct {
+	Tier UserTier `json:"tier"`
+}
+
+func IsKnownUserTier(tier UserTier) bool {
+	for _, known := range userTiers {
+		if known == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultQueueRoutes sends every tier to the same queue, separated by priority only
+func DefaultQueueRoutes(queueName string) map[UserTier]QueueRoute {
+	return map[UserTier]QueueRoute{
+		TierPremium: {QueueName: queueName, Priority: 1},
+		TierStandard: {QueueName: queueName, Priority: 10},
+		TierBulk: {QueueName: queueName, Priority: 100},
+	}
+}
+
+// ParseQueueRoutes parses routing rules of the form "premium=queue:1,standard=queue:10,bulk=bulk-queue:100".
+// Tiers missing from the rules keep their default route.
+func ParseQueueRoutes(rules string, defaultQueue string) (map[UserTier]QueueRoute, error) {
+	routes := DefaultQueueRoutes(defaultQueue)
+	if strings.TrimSpace(rules) == "" {
+		return routes, nil
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		tierAndRoute := strings.SplitN(strings.TrimSpace(rule), "=", 2)
+		if len(tierAndRoute) != 2 {
+			return nil, fmt.Errorf("invalid queue route %q", rule)
+		}
+		tier := UserTier(tierAndRoute[0])
+		if !IsKnownUserTier(tier) {
+			return nil, fmt.Errorf("unknown tier %q in queue route", tier)
+		}
+		route := QueueRoute{QueueName: tierAndRoute[1]}
+		if separator := strings.LastIndex(tierAndRoute[1], ":"); separator != -1 {
+			priority, err := strconv.Atoi(tierAndRoute[1][separator+1:])
+			if err != nil || priority < 0 {
+				return nil, fmt.Errorf("invalid priority in queue route %q", rule)
+			}
+			route = QueueRoute{QueueName: tierAndRoute[1][:separator], Priority: priority}
+		}
+		if route.QueueName == "" {
+			return nil, fmt.Errorf("missing queue name in queue route %q", rule)
+		}
+		routes[tier] = route
+	}
+	return routes, nil
+}
+
+// RouteJob picks the queue and job options of a user's next job from their tier and number of unfinished jobs
+func RouteJob(userId string) (string, JobOptions, error) {
+	jobOptions := publisherOptions.DefaultJobOptions
+	tier, err := GetUserTier(userId)
+	if err != nil {
+		return "", jobOptions, err
+	}
+	route, ok := publisherOptions.Routes[tier]
+	if !ok {
+		route = QueueRoute{QueueName: publisherOptions.QueueName}
+	}
+	if route.Priority > 0 {
+		jobOptions.Priority = route.Priority
+	}
+	fairness := publisherOptions.Fairness
+	if fairness.Step > 0 {
+		inFlight, err := CountUnfinishedImages(userId)
+		if err != nil {
+			return "", jobOptions, err
+		}
+		penalty := inFlight / fairness.Step
+		if fairness.MaxPenalty > 0 && penalty > fairness.MaxPenalty {
+			penalty = fairness.MaxPenalty
+		}
+		jobOptions.Priority += penalty
+	}
+	return route.QueueName, jobOptions, nil
+}
+
+func getUserTier(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	tier, err := GetUserTier(userId)
+	if err != nil {
+		returnAppError(w, "Unable to get user tier", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UserTierBody{Tier: tier})
+}
+
+func setUserTier(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	var body UserTierBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || !IsKnownUserTier(body.Tier) {
+		returnAppError(w, "Tier must be one of premium, standard or bulk", http.StatusBadRequest, nil)
+		return
+	}
+	err = SetUserTier(userId, body.Tier)
+	if err != nil {
+		returnAppError(w, "Unable to set user tier", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
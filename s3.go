@@ -1,9 +1,13 @@
 package main
 import (
 	"context"
+	"fmt"
+	"io"
+	"time"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"errors"
 )
 
@@ -50,6 +54,97 @@ func UploadFileToS3(s3Object *s3.PutObjectInput) error {
 	return nil
 }
 
+func DownloadFileFromS3(key string) ([]byte, error) {
+	if S3Client == nil {
+		return nil, errors.New("S3 client not connected")
+	}
+	output, err := S3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(S3Bucket),
+		Key: aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
+
+// OpenFileFromS3 streams an object, the caller closes the returned body
+func OpenFileFromS3(key string) (io.ReadCloser, error) {
+	if S3Client == nil {
+		return nil, errors.New("S3 client not connected")
+	}
+	output, err := S3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(S3Bucket),
+		Key: aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+// PresignDownloadURL returns a URL granting read access to the object for ttl
+func PresignDownloadURL(key string, ttl time.Duration) (string, error) {
+	if S3Client == nil {
+		return "", errors.New("S3 client not connected")
+	}
+	request, err := s3.NewPresignClient(S3Client).PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(S3Bucket),
+		Key: aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+	return request.URL, nil
+}
+
+func DeleteFileFromS3(key string) error {
+	if S3Client == nil {
+		return errors.New("S3 client not connected")
+	}
+	_, err := S3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(S3Bucket),
+		Key: aws.String(key),
+	})
+	return err
+}
+
+// DeleteFolderFromS3 removes every object whose key starts with prefix
+func DeleteFolderFromS3(prefix string) error {
+	if S3Client == nil {
+		return errors.New("S3 client not connected")
+	}
+	paginator := s3.NewListObjectsV2Paginator(S3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(S3Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return err
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+		objects := make([]types.ObjectIdentifier, len(page.Contents))
+		for i, object := range page.Contents {
+			objects[i] = types.ObjectIdentifier{Key: object.Key}
+		}
+		output, err := S3Client.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(S3Bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(output.Errors) > 0 {
+			return fmt.Errorf("unable to delete %s: %s", aws.ToString(output.Errors[0].Key), aws.ToString(output.Errors[0].Message))
+		}
+	}
+	return nil
+}
+
 func GetS3Bucket() string {
 	return S3Bucket
 }
\ No newline at end of file
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Jobs can be scheduled at most this far ahead
+const maxScheduleAhead = 30 * 24 * time.Hour
+
+type ScheduleBody struct {
+	// RFC 3339 time to process the image at
+	ProcessAt string `json:"process_at"`
+	// Daily UTC window such as 22:00-06:00, the image is processed when the window next opens
+	ProcessWindow string `json:"process_window"`
+}
+
+// parseSchedule reads the optional process_at and process_window form values of an upload
+func parseSchedule(r *http.Request) (sql.NullTime, error) {
+	return resolveSchedule(ScheduleBody{
+		ProcessAt: r.FormValue("process_at"),
+		ProcessWindow: r.FormValue("process_window"),
+	}, time.Now())
+}
+
+// resolveSchedule returns when the job should run, an invalid time means as soon as possible
+func resolveSchedule(body ScheduleBody, now time.Time) (sql.NullTime, error) {
+	processAt := strings.TrimSpace(body.ProcessAt)
+	processWindow := strings.TrimSpace(body.ProcessWindow)
+	if processAt != "" && processWindow != "" {
+		return sql.NullTime{}, errors.New("process_at and process_window cannot be combined")
+	}
+	var scheduledAt time.Time
+	var err error
+	switch {
+	case processAt != "":
+		scheduledAt, err = time.Parse(time.RFC3339, processAt)
+		if err != nil {
+			return sql.NullTime{}, errors.New("process_at must be an RFC 3339 time")
+		}
+	case processWindow != "":
+		scheduledAt, err = nextWindowStart(processWindow, now)
+		if err != nil {
+			return sql.NullTime{}, err
+		}
+	default:
+		return sql.NullTime{}, nil
+	}
+	if scheduledAt.After(now.Add(maxScheduleAhead)) {
+		return sql.NullTime{}, fmt.Errorf("jobs cannot be scheduled more than %d days ahead", int(maxScheduleAhead.Hours()/24))
+	}
+	if !scheduledAt.After(now) {
+		return sql.NullTime{}, nil
+	}
+	return sql.NullTime{Time: scheduledAt.UTC(), Valid: true}, nil
+}
+
+// nextWindowStart returns now when it falls inside the daily window, otherwise the next time the window opens
+func nextWindowStart(window string, now time.Time) (time.Time, error) {
+	bounds := strings.Split(window, "-")
+	if len(bounds) != 2 {
+		return time.Time{}, errors.New("process_window must be formatted as HH:MM-HH:MM")
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return time.Time{}, errors.New("process_window must be formatted as HH:MM-HH:MM")
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return time.Time{}, errors.New("process_window must be formatted as HH:MM-HH:MM")
+	}
+	now = now.UTC()
+	minuteOfDay := func(t time.Time) int { return t.Hour()*60 + t.Minute() }
+	current, startMinute, endMinute := minuteOfDay(now), minuteOfDay(start), minuteOfDay(end)
+	if startMinute == endMinute {
+		return time.Time{}, errors.New("process_window cannot be empty")
+	}
+	// Windows such as 22:00-06:00 wrap around midnight
+	inWindow := current >= startMinute && current < endMinute
+	if startMinute > endMinute {
+		inWindow = current >= startMinute || current < endMinute
+	}
+	if inWindow {
+		return now, nil
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), start.Hour(), start.Minute(), 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// jobDelay returns how long a job scheduled at scheduledAt must wait
+func jobDelay(scheduledAt sql.NullTime) time.Duration {
+	if !scheduledAt.Valid {
+		return 0
+	}
+	delay := time.Until(scheduledAt.Time)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+func rescheduleImage(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	imageID := mux.Vars(r)["image_id"]
+	if userId == "" || imageID == "" {
+		returnAppError(w, "User ID or image ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	var body ScheduleBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		returnAppError(w, "Invalid request body", http.StatusBadRequest, err)
+		return
+	}
+	scheduledAt, err := resolveSchedule(body, time.Now())
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	imageResponse, err := GetImageById(imageID, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to get image", http.StatusInternalServerError, err)
+		return
+	}
+	if JobStatus(imageResponse.Image.JOB_STATUS) != JobInQueue {
+		returnAppError(w, "Image cannot be rescheduled in status "+imageResponse.Image.JOB_STATUS, http.StatusConflict, nil)
+		return
+	}
+	// Delayed jobs are not locked, so the job can be replaced unless a worker already picked it up
+	started, err := CancelJob(imageID)
+	if err != nil {
+		returnAppError(w, "Unable to remove scheduled job", http.StatusInternalServerError, err)
+		return
+	}
+	if started {
+		returnAppError(w, "Image is already being processed", http.StatusConflict, nil)
+		return
+	}
+	updated, err := SetImageSchedule(imageID, userId, scheduledAt)
+	if err != nil {
+		returnAppError(w, "Unable to reschedule image", http.StatusInternalServerError, err)
+		return
+	}
+	if !updated {
+		returnAppError(w, "Image is no longer in queue", http.StatusConflict, nil)
+		return
+	}
+	err = enqueueImageJob(imageID, userId, imageObjectName(imageResponse.Image.Filename, imageResponse.Image.Version), imageResponse.Image.ProcessingOptions, scheduledAt)
+	if err != nil {
+		returnAppError(w, "Unable to enqueue image", http.StatusInternalServerError, err)
+		return
+	}
+	imageResponse.Image.ScheduledAt = scheduledAt
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(imageResponse.Image)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	shareTokenSize = 24
+	// bcrypt ignores everything after 72 bytes
+	maxSharePasswordLength = 72
+	// Wrong passwords in a row after which the link rejects passwords for sharePasswordLockout
+	sharePasswordMaxFailures = 5
+	sharePasswordLockout = 15 * time.Minute
+)
+
+type ShareLink struct {
+	Token string `json:"token"`
+	UserId string `json:"user_id"`
+	// Exactly one of ImageID and AlbumID is set
+	ImageID sql.NullString `json:"image_id"`
+	AlbumID sql.NullString `json:"album_id"`
+	Variant string `json:"variant"`
+	PasswordHash sql.NullString `json:"-"`
+	ExpiresAt sql.NullTime `json:"expires_at"`
+	MaxViews sql.NullInt64 `json:"max_views"`
+	Views int `json:"views"`
+	CreatedAt time.Time `json:"created_at"`
+	PasswordFailures int `json:"-"`
+	LockedUntil sql.NullTime `json:"-"`
+	// Path of the public link
+	URL string `json:"url"`
+	HasPassword bool `json:"has_password"`
+}
+
+type ShareLinkBody struct {
+	ImageID string `json:"image_id"`
+	AlbumID string `json:"album_id"`
+	// original, compressed or thumbnail, compressed when empty
+	Variant string `json:"variant"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	MaxViews int `json:"max_views"`
+	Password string `json:"password"`
+}
+
+// withShareDetails fills the fields derived from the stored ones
+func withShareDetails(share ShareLink) ShareLink {
+	share.URL = "/s/" + share.Token
+	share.HasPassword = share.PasswordHash.Valid
+	return share
+}
+
+func generateShareToken() (string, error) {
+	token := make([]byte, shareTokenSize)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// writeStorageObject copies an opened object to the client and closes it.
+// The content type is sniffed since originals are stored without one.
+func writeStorageObject(w http.ResponseWriter, body io.ReadCloser, filename string) {
+	defer body.Close()
+	reader := bufio.NewReader(body)
+	head, _ := reader.Peek(512)
+	w.Header().Set("Content-Type", http.DetectContentType(head))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	_, err := io.Copy(w, reader)
+	if err != nil {
+		logStructured(ERROR, "Unable to stream object: "+filename, err, 0, false)
+	}
+}
+
+func createShareLink(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	var body ShareLinkBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		returnAppError(w, "Invalid request body", http.StatusBadRequest, err)
+		return
+	}
+	if (body.ImageID == "") == (body.AlbumID == "") {
+		returnAppError(w, "Either image_id or album_id is required", http.StatusBadRequest, nil)
+		return
+	}
+	if body.Variant == "" {
+		body.Variant = "compressed"
+	}
+	if body.Variant != "original" && body.Variant != "compressed" && body.Variant != "thumbnail" {
+		returnAppError(w, "variant must be original, compressed or thumbnail", http.StatusBadRequest, nil)
+		return
+	}
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		returnAppError(w, "expires_at must be in the future", http.StatusBadRequest, nil)
+		return
+	}
+	if body.MaxViews < 0 {
+		returnAppError(w, "max_views must be a positive integer", http.StatusBadRequest, nil)
+		return
+	}
+	if len(body.Password) > maxSharePasswordLength {
+		returnAppError(w, fmt.Sprintf("password must be at most %d bytes", maxSharePasswordLength), http.StatusBadRequest, nil)
+		return
+	}
+
+	if body.ImageID != "" {
+		_, err = GetImageById(body.ImageID, userId)
+		if errors.Is(err, sql.ErrNoRows) {
+			returnAppError(w, "Image not found", http.StatusNotFound, nil)
+			return
+		}
+	} else {
+		_, err = GetAlbum(body.AlbumID, userId)
+		if errors.Is(err, sql.ErrNoRows) {
+			returnAppError(w, "Album not found", http.StatusNotFound, nil)
+			return
+		}
+	}
+	if err != nil {
+		returnAppError(w, "Unable to get shared item", http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := generateShareToken()
+	if err != nil {
+		returnAppError(w, "Unable to generate token", http.StatusInternalServerError, err)
+		return
+	}
+	share := ShareLink{
+		Token: token,
+		UserId: userId,
+		ImageID: sql.NullString{String: body.ImageID, Valid: body.ImageID != ""},
+		AlbumID: sql.NullString{String: body.AlbumID, Valid: body.AlbumID != ""},
+		Variant: body.Variant,
+		MaxViews: sql.NullInt64{Int64: int64(body.MaxViews), Valid: body.MaxViews > 0},
+		CreatedAt: time.Now(),
+	}
+	if body.ExpiresAt != nil {
+		share.ExpiresAt = sql.NullTime{Time: *body.ExpiresAt, Valid: true}
+	}
+	if body.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+		if err != nil {
+			returnAppError(w, "Unable to hash password", http.StatusInternalServerError, err)
+			return
+		}
+		share.PasswordHash = sql.NullString{String: string(hash), Valid: true}
+	}
+	err = InsertShareLink(share)
+	if err != nil {
+		returnAppError(w, "Unable to save share link", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(withShareDetails(share))
+}
+
+func getShareLinks(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	shares, err := GetShareLinks(userId)
+	if err != nil {
+		returnAppError(w, "Unable to get share links", http.StatusInternalServerError, err)
+		return
+	}
+	for i := range shares {
+		shares[i] = withShareDetails(shares[i])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shares)
+}
+
+func deleteShareLink(w http.ResponseWriter, r *http.Request) {
+	err := DeleteShareLink(mux.Vars(r)["token"], mux.Vars(r)["user_id"])
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Share link not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to delete share link", http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveShareLink is the unauthenticated endpoint behind share links.
+// Images are served inline and albums as a ZIP, the password is read from the X-Share-Password header.
+// Only successful requests count as views, the view is counted once the image was opened or the album's images were loaded.
+func serveShareLink(w http.ResponseWriter, r *http.Request) {
+	share, err := GetShareLink(mux.Vars(r)["token"])
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Share link not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to get share link", http.StatusInternalServerError, err)
+		return
+	}
+	if share.ExpiresAt.Valid && !share.ExpiresAt.Time.After(time.Now()) {
+		returnAppError(w, "Share link expired", http.StatusGone, nil)
+		return
+	}
+	if share.PasswordHash.Valid && !checkSharePassword(w, r, share) {
+		return
+	}
+
+	var image ImageSchema
+	var album Album
+	if share.ImageID.Valid {
+		var imageResponse ImageResponse
+		imageResponse, err = GetImageById(share.ImageID.String, share.UserId)
+		image = imageResponse.Image
+	} else {
+		album, err = GetAlbum(share.AlbumID.String, share.UserId)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Shared item no longer exists", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to get shared item", http.StatusInternalServerError, err)
+		return
+	}
+
+	var body io.ReadCloser
+	var images []ImageSchema
+	if share.ImageID.Valid {
+		body, err = OpenFileFromS3(imageStorageKey(image, share.Variant))
+	} else {
+		images, err = GetAlbumImages(album.ID)
+	}
+	if err != nil {
+		returnAppError(w, "Unable to read shared item", http.StatusInternalServerError, err)
+		return
+	}
+	counted, err := CountShareLinkView(share.Token)
+	if err != nil || !counted {
+		if body != nil {
+			body.Close()
+		}
+		if err != nil {
+			returnAppError(w, "Unable to record view", http.StatusInternalServerError, err)
+		} else {
+			returnAppError(w, "Share link expired", http.StatusGone, nil)
+		}
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	if share.ImageID.Valid {
+		writeStorageObject(w, body, image.DisplayName)
+		return
+	}
+	writeAlbumArchive(w, album, images, share.Variant)
+}
+
+// checkSharePassword answers the request itself unless the X-Share-Password header matches.
+// After sharePasswordMaxFailures wrong passwords in a row the link is locked, which also spares bcrypt work during brute force attempts.
+func checkSharePassword(w http.ResponseWriter, r *http.Request, share ShareLink) bool {
+	if share.LockedUntil.Valid && share.LockedUntil.Time.After(time.Now()) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(share.LockedUntil.Time).Seconds())+1))
+		returnAppError(w, "Too many wrong passwords, try again later", http.StatusTooManyRequests, nil)
+		return false
+	}
+	// Query parameters would end up in access logs and Referer headers
+	password := r.Header.Get("X-Share-Password")
+	if password == "" {
+		returnAppError(w, "Password required", http.StatusUnauthorized, nil)
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(share.PasswordHash.String), []byte(password)) != nil {
+		err := RecordSharePasswordFailure(share.Token, sharePasswordMaxFailures, time.Now().Add(sharePasswordLockout))
+		if err != nil {
+			logStructured(ERROR, "Unable to record wrong share password", err, 0, false)
+		}
+		returnAppError(w, "Wrong password", http.StatusUnauthorized, nil)
+		return false
+	}
+	if share.PasswordFailures > 0 {
+		err := ResetSharePasswordFailures(share.Token)
+		if err != nil {
+			logStructured(ERROR, "Unable to reset share password failures", err, 0, false)
+		}
+	}
+	return true
+}
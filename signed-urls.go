@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gorilla/mux"
+)
+
+type URLSigningOptions struct {
+	// The first secret signs new URLs, all of them are accepted so secrets can be rotated without breaking issued URLs
+	Secrets []string
+	// Prepended to signed paths, for example the CDN origin. Empty for paths relative to the API.
+	BaseURL string
+	DefaultTTL time.Duration
+	MaxTTL time.Duration
+}
+
+var urlSigningOptions URLSigningOptions
+
+type SignedURLResponse struct {
+	URL string `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ParseURLSigningSecrets reads the comma separated secrets, newest first
+func ParseURLSigningSecrets(value string) ([]string, error) {
+	secrets := []string{}
+	for _, secret := range strings.Split(value, ",") {
+		secret = strings.TrimSpace(secret)
+		if secret == "" {
+			continue
+		}
+		if len(secret) < 32 {
+			return nil, errors.New("signing secrets must be at least 32 characters")
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+func InitializeURLSigning(options URLSigningOptions) {
+	urlSigningOptions = options
+	if len(options.Secrets) == 0 {
+		fmt.Println("Signed image URLs disabled, no signing secret configured")
+		return
+	}
+	fmt.Println("Signed image URLs enabled with", len(options.Secrets), "active secrets")
+}
+
+// signImagePath signs everything needed to locate the object, so serving a signed URL needs no database lookup
+func signImagePath(secret string, imageID string, variant string, userId string, object string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%d", imageID, variant, userId, object, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyImagePath accepts signatures made with any active secret
+func verifyImagePath(signature string, imageID string, variant string, userId string, object string, expires int64) bool {
+	for _, secret := range urlSigningOptions.Secrets {
+		expected := signImagePath(secret, imageID, variant, userId, object, expires)
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignedImageURL returns a URL serving the variant of the image until expires
+func SignedImageURL(image ImageSchema, variant string, expires time.Time) string {
+	object := imageObjectName(image.Filename, image.Version)
+	query := url.Values{}
+	query.Set("u", image.UserId)
+	query.Set("o", object)
+	query.Set("exp", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("sig", signImagePath(urlSigningOptions.Secrets[0], image.ImageID, variant, image.UserId, object, expires.Unix()))
+	return fmt.Sprintf("%s/img/%s/%s?%s", urlSigningOptions.BaseURL, url.PathEscape(image.ImageID), variant, query.Encode())
+}
+
+// getSignedImageURL issues a signed URL for an image of the user, ttl is given in seconds
+func getSignedImageURL(w http.ResponseWriter, r *http.Request) {
+	if len(urlSigningOptions.Secrets) == 0 {
+		returnAppError(w, "Signed URLs are not configured", http.StatusNotImplemented, nil)
+		return
+	}
+	variant := r.URL.Query().Get("variant")
+	if variant == "" {
+		variant = "compressed"
+	}
+	if variant != "original" && variant != "compressed" && variant != "thumbnail" {
+		returnAppError(w, "variant must be original, compressed or thumbnail", http.StatusBadRequest, nil)
+		return
+	}
+	ttl := urlSigningOptions.DefaultTTL
+	if value := r.URL.Query().Get("ttl"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 1 || time.Duration(seconds)*time.Second > urlSigningOptions.MaxTTL {
+			returnAppError(w, fmt.Sprintf("ttl must be between 1 and %d seconds", int(urlSigningOptions.MaxTTL.Seconds())), http.StatusBadRequest, nil)
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	imageResponse, err := GetImageById(mux.Vars(r)["image_id"], mux.Vars(r)["user_id"])
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to get image", http.StatusInternalServerError, err)
+		return
+	}
+	expires := time.Now().Add(ttl)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SignedURLResponse{
+		URL: SignedImageURL(imageResponse.Image, variant, expires),
+		ExpiresAt: expires.UTC().Truncate(time.Second),
+	})
+}
+
+// serveSignedImage serves /img/{image_id}/{variant} after checking the signature and expiry.
+// The compressed variant falls back to the original while the image is not compressed yet.
+func serveSignedImage(w http.ResponseWriter, r *http.Request) {
+	imageID := mux.Vars(r)["image_id"]
+	variant := mux.Vars(r)["variant"]
+	query := r.URL.Query()
+	userId := query.Get("u")
+	object := query.Get("o")
+	expires, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil || len(urlSigningOptions.Secrets) == 0 || userId == "" || object == "" {
+		returnAppError(w, "Invalid signed URL", http.StatusForbidden, nil)
+		return
+	}
+	if !verifyImagePath(query.Get("sig"), imageID, variant, userId, object, expires) {
+		returnAppError(w, "Invalid signature", http.StatusForbidden, nil)
+		return
+	}
+	remaining := time.Until(time.Unix(expires, 0))
+	if remaining <= 0 {
+		returnAppError(w, "Signed URL expired", http.StatusGone, nil)
+		return
+	}
+
+	folder := Uploads
+	switch variant {
+	case "thumbnail":
+		folder = Thumbnail
+	case "compressed":
+		folder = Resized
+	}
+	// Caches may keep the response until the URL expires
+	cacheControl := fmt.Sprintf("public, max-age=%d, immutable", int(remaining.Seconds()))
+	body, err := OpenFileFromS3(fmt.Sprintf("%s/%s/%s/%s", folder, userId, imageID, object))
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) && variant == "compressed" {
+		// The compressed image replaces the original once available, caches have to check again
+		cacheControl = "no-cache"
+		body, err = OpenFileFromS3(fmt.Sprintf("%s/%s/%s/%s", Uploads, userId, imageID, object))
+	}
+	if errors.As(err, &noSuchKey) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to read image from storage", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	writeStorageObject(w, body, path.Base(object))
+}
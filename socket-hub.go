@@ -0,0 +1,198 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Maximum number of pending messages per connection before it is considered slow
+	wsSendBufferSize = 32
+	// Time allowed to write a single message to the peer
+	wsWriteWait = 10 * time.Second
+	// Time allowed to read the next pong from the peer
+	wsPongWait = 60 * time.Second
+	// Pings are sent at this interval, must be less than wsPongWait
+	wsPingPeriod = (wsPongWait * 9) / 10
+	// Clients only send control frames so inbound messages are kept small
+	wsMaxMessageSize = 512
+)
+
+// sequencedMessage is implemented by messages that carry a per-user sequence ID
+type sequencedMessage interface {
+	Sequence() int64
+}
+
+type WSClient struct {
+	UserId string
+	conn *websocket.Conn
+	send chan interface{}
+	// Loads missed messages to deliver before any live message, may be nil
+	replay func() ([]sequencedMessage, error)
+}
+
+type WSHub struct {
+	mutex sync.RWMutex
+	clients map[string]map[*WSClient]bool
+}
+
+var wsHub = NewWSHub()
+
+func NewWSHub() *WSHub {
+	return &WSHub{
+		clients: make(map[string]map[*WSClient]bool),
+	}
+}
+
+// Register adds a connection for the user and starts its send goroutine.
+// replay is called after registration so that no live message is missed between loading the backlog and going live.
+func (h *WSHub) Register(userId string, conn *websocket.Conn, replay func() ([]sequencedMessage, error)) *WSClient {
+	client := h.Subscribe(userId)
+	client.conn = conn
+	client.replay = replay
+	go client.writePump(h)
+	return client
+}
+
+// Subscribe adds a subscriber without a websocket connection, the caller drains Messages itself.
+// Used by transports other than websockets such as the SSE feed.
+func (h *WSHub) Subscribe(userId string) *WSClient {
+	client := &WSClient{
+		UserId: userId,
+		send: make(chan interface{}, wsSendBufferSize),
+	}
+	h.mutex.Lock()
+	if h.clients[userId] == nil {
+		h.clients[userId] = make(map[*WSClient]bool)
+	}
+	h.clients[userId][client] = true
+	h.mutex.Unlock()
+	return client
+}
+
+// Messages returns the subscriber's channel, closed once it is unregistered
+func (c *WSClient) Messages() <-chan interface{} {
+	return c.send
+}
+
+// Unregister removes the connection and stops its send goroutine. Safe to call more than once.
+func (h *WSHub) Unregister(client *WSClient) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.remove(client)
+}
+
+// remove must be called with the write lock held
+func (h *WSHub) remove(client *WSClient) {
+	userClients := h.clients[client.UserId]
+	if userClients == nil || !userClients[client] {
+		return
+	}
+	delete(userClients, client)
+	if len(userClients) == 0 {
+		delete(h.clients, client.UserId)
+	}
+	close(client.send)
+}
+
+// Broadcast queues the message on every connection of the user.
+// Connections whose buffer is full are disconnected instead of blocking the caller.
+func (h *WSHub) Broadcast(userId string, message interface{}) {
+	var slowClients []*WSClient
+	h.mutex.RLock()
+	for client := range h.clients[userId] {
+		select {
+		case client.send <- message:
+		default:
+			slowClients = append(slowClients, client)
+		}
+	}
+	h.mutex.RUnlock()
+
+	if len(slowClients) == 0 {
+		return
+	}
+	h.mutex.Lock()
+	for _, client := range slowClients {
+		logStructured(WARN, "Disconnecting slow websocket consumer for user: "+client.UserId, nil, 0, false)
+		h.remove(client)
+	}
+	h.mutex.Unlock()
+}
+
+func (c *WSClient) writePump(h *WSHub) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	lastSeq := int64(0)
+	if c.replay != nil {
+		messages, err := c.replay()
+		if err != nil {
+			logStructured(WARN, "Unable to replay websocket backlog for user: "+c.UserId, err, 0, false)
+		}
+		for _, message := range messages {
+			if !c.write(h, message) {
+				return
+			}
+			lastSeq = message.Sequence()
+		}
+	}
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteWait))
+				return
+			}
+			// Skip live messages that were already delivered by the replay
+			if sequenced, isSequenced := message.(sequencedMessage); isSequenced && sequenced.Sequence() != 0 && sequenced.Sequence() <= lastSeq {
+				continue
+			}
+			if !c.write(h, message) {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			err := c.conn.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				h.Unregister(c)
+				return
+			}
+		}
+	}
+}
+
+func (c *WSClient) write(h *WSHub, message interface{}) bool {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	err := c.conn.WriteJSON(message)
+	if err != nil {
+		logStructured(WARN, "Unable to write to websocket for user: "+c.UserId, err, 0, false)
+		h.Unregister(c)
+		return false
+	}
+	return true
+}
+
+// readPump consumes inbound frames to process pongs and detect closed connections.
+// It blocks until the connection fails or misses a heartbeat.
+func (c *WSClient) readPump(h *WSHub) {
+	defer h.Unregister(c)
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		return nil
+	})
+	for {
+		_, _, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+	}
+}
@@ -2,58 +2,322 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+
 	"github.com/redis/go-redis/v9"
-	"github.com/gorilla/websocket"
 	"encoding/json"
 )
 
-var redisEventSubscriber *redis.Client = nil
-var clients = make(map[string]*websocket.Conn)
+const (
+	// Persisted progress events are re-published here for every replica to fan out to its own websocket clients
+	progressDeliveryStream = "image-processor-progress:delivery"
+	progressDeliveryMaxLen = 10000
+	// Pending entries idle for longer than this are considered abandoned by a crashed replica
+	progressClaimMinIdle = time.Minute
+	progressReclaimInterval = 30 * time.Second
+	// Entries failing this many times are acknowledged and dropped
+	progressMaxDeliveries = 5
+	progressReadBlock = 5 * time.Second
+)
+
+// EventSubscriber receives progress events reported by the executor and distributes them to every replica.
+// RedisEventSubscriber is the default, MemoryBroker runs without Redis.
+type EventSubscriber interface {
+	// Report adds an event the way the job executor does
+	Report(message ImageProcessorProgressMessage) error
+	// Consume calls handle for each reported event, once across all replicas. Events for which handle returns false are redelivered later.
+	Consume(handle func(ImageProcessorProgressMessage) bool)
+	// Deliver assigns the event its per-user sequence ID, keeps it for replay and passes it to FanOut on every replica
+	Deliver(message ImageProcessorProgressMessage) error
+	// FanOut calls handle for every delivered event on this replica
+	FanOut(handle func(ImageProcessorProgressMessage))
+	// EventsSince returns the delivered events of the user with a sequence ID greater than since
+	EventsSince(userId string, since int64) ([]ImageProcessorProgressMessage, error)
+	Close() error
+}
+
+var eventSubscriber EventSubscriber = nil
+
+type EventSubscriberOptions struct {
+	// Stream the job executor adds progress events to
+	Stream string
+	// Consumer group shared by all API replicas
+	Group string
+	// Unique name of this replica within the group
+	Consumer string
+}
 
 type ImageProcessorProgressMessage struct {
+	// Empty for image jobs, "export" for export jobs which carry ExportID instead of ImageID
+	Type string `json:"type,omitempty"`
+	ExportID string `json:"export_id,omitempty"`
 	ImageID string `json:"image_id"`
 	UserId string `json:"user_id"`
 	Filename string `json:"filename"`
 	Progress int `json:"progress"`
 	Status string `json:"status"`
+	// Size in bytes of the compressed output, reported with the completed status
+	CompressedSize int64 `json:"compressed_size,omitempty"`
+	Seq int64 `json:"seq,omitempty"`
+}
+
+// Sequence implements sequencedMessage so the hub can skip events already replayed
+func (m ImageProcessorProgressMessage) Sequence() int64 {
+	return m.Seq
+}
+
+func InitializeEventSubscriber(subscriber EventSubscriber) {
+	eventSubscriber = subscriber
+}
+
+func CloseEventSubscriber() {
+	if eventSubscriber != nil {
+		eventSubscriber.Close()
+		eventSubscriber = nil
+	}
+}
+
+// StartProgressEvents persists reported progress events and forwards delivered ones to local websocket and SSE clients
+func StartProgressEvents() {
+	go eventSubscriber.Consume(processProgressEvent)
+	go eventSubscriber.FanOut(func(message ImageProcessorProgressMessage) {
+		wsHub.Broadcast(message.UserId, message)
+	})
+}
+
+// processProgressEvent persists a single progress event and hands it over for delivery.
+// Returns false when the event should be retried.
+func processProgressEvent(imageProcessorProgressMessage ImageProcessorProgressMessage) bool {
+	err := ApplyJobProgress(imageProcessorProgressMessage)
+	if errors.Is(err, ErrIllegalJobTransition) {
+		logStructured(WARN, "Rejected progress event for image: "+imageProcessorProgressMessage.ImageID, err, 0, false)
+		return true
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		logStructured(WARN, "Progress event for unknown image: "+imageProcessorProgressMessage.ImageID, nil, 0, false)
+		return true
+	}
+	if err != nil {
+		logStructured(ERROR, "Unable to persist progress event for image: "+imageProcessorProgressMessage.ImageID, err, 0, false)
+		return false
+	}
+	NotifyProgress(imageProcessorProgressMessage)
+	return true
+}
+
+// NotifyProgress sends an already persisted progress event to the user's websocket and SSE clients on every replica
+func NotifyProgress(message ImageProcessorProgressMessage) {
+	if eventSubscriber == nil {
+		return
+	}
+	err := eventSubscriber.Deliver(message)
+	if err != nil {
+		logStructured(ERROR, "Unable to publish progress event for delivery", err, 0, false)
+	}
 }
 
-func InitializeEventSubscriber(redisUrl string) error {
+// RedisEventSubscriber reads progress events from a Redis Stream through a consumer group
+type RedisEventSubscriber struct {
+	client *redis.Client
+	options EventSubscriberOptions
+}
+
+func NewRedisEventSubscriber(redisUrl string, options EventSubscriberOptions) (*RedisEventSubscriber, error) {
 	opt, err := redis.ParseURL(redisUrl)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	redis := redis.NewClient(opt)
-	redisEventSubscriber = redis
 	pong, err := redis.Ping(context.Background()).Result()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	fmt.Println("Redis Event Subscriber connected successfully", pong)
-	return nil
+	err = redis.XGroupCreateMkStream(context.Background(), options.Stream, options.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+	fmt.Println("Progress consumer group ready:", options.Group, "as", options.Consumer)
+	return &RedisEventSubscriber{client: redis, options: options}, nil
 }
 
-func CloseEventSubscriber() {
-	redisEventSubscriber.Close()
-	redisEventSubscriber = nil
+func (s *RedisEventSubscriber) Close() error {
+	return s.client.Close()
 }
 
-func SubscribeToEvent(event string) {
-	pubsub := redisEventSubscriber.Subscribe(context.Background(), event)
-	defer pubsub.Close()
-	for msg := range pubsub.Channel() {
-		var imageProcessorProgressMessage ImageProcessorProgressMessage
-		err := json.Unmarshal([]byte(msg.Payload), &imageProcessorProgressMessage)
+// Consume reads through the consumer group so each event is handled by exactly one replica.
+// Entries left pending by a previous run of this consumer are processed before new ones.
+func (s *RedisEventSubscriber) Consume(handle func(ImageProcessorProgressMessage) bool) {
+	go s.reclaimPending(handle)
+	lastId := "0"
+	for {
+		streams, err := s.client.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+			Group: s.options.Group,
+			Consumer: s.options.Consumer,
+			Streams: []string{s.options.Stream, lastId},
+			Count: 10,
+			Block: progressReadBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if errors.Is(err, redis.ErrClosed) {
+			return
+		}
 		if err != nil {
-			fmt.Println("Error parsing message:", err)
+			logStructured(ERROR, "Unable to read progress stream", err, 0, false)
+			time.Sleep(time.Second)
 			continue
 		}
-		client := clients[imageProcessorProgressMessage.UserId]
-		if client == nil {
+		entries := streams[0].Messages
+		// Own pending history is exhausted, switch to new entries
+		if lastId != ">" && len(entries) == 0 {
+			lastId = ">"
 			continue
 		}
-		client.WriteJSON(imageProcessorProgressMessage)
+		for _, entry := range entries {
+			if s.handleEntry(entry, handle) {
+				s.client.XAck(context.Background(), s.options.Stream, s.options.Group, entry.ID)
+			}
+		}
+		if lastId != ">" {
+			lastId = entries[len(entries)-1].ID
+		}
+	}
+}
+
+// reclaimPending takes over entries left unacknowledged by crashed replicas
+func (s *RedisEventSubscriber) reclaimPending(handle func(ImageProcessorProgressMessage) bool) {
+	ticker := time.NewTicker(progressReclaimInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx := context.Background()
+		pending, err := s.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: s.options.Stream,
+			Group: s.options.Group,
+			Idle: progressClaimMinIdle,
+			Start: "-",
+			End: "+",
+			Count: 100,
+		}).Result()
+		if errors.Is(err, redis.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logStructured(ERROR, "Unable to list pending progress events", err, 0, false)
+			continue
+		}
+		for _, entry := range pending {
+			if entry.RetryCount >= progressMaxDeliveries {
+				logStructured(ERROR, fmt.Sprintf("Dropping progress event %s after %d deliveries", entry.ID, entry.RetryCount), nil, 0, false)
+				s.client.XAck(ctx, s.options.Stream, s.options.Group, entry.ID)
+				continue
+			}
+			claimed, err := s.client.XClaim(ctx, &redis.XClaimArgs{
+				Stream: s.options.Stream,
+				Group: s.options.Group,
+				Consumer: s.options.Consumer,
+				MinIdle: progressClaimMinIdle,
+				Messages: []string{entry.ID},
+			}).Result()
+			if err != nil {
+				logStructured(ERROR, "Unable to claim progress event "+entry.ID, err, 0, false)
+				continue
+			}
+			for _, message := range claimed {
+				if s.handleEntry(message, handle) {
+					s.client.XAck(ctx, s.options.Stream, s.options.Group, message.ID)
+				}
+			}
+		}
 	}
+}
 
-}
\ No newline at end of file
+// handleEntry decodes a stream entry, malformed entries are acknowledged without calling handle
+func (s *RedisEventSubscriber) handleEntry(entry redis.XMessage, handle func(ImageProcessorProgressMessage) bool) bool {
+	payload, ok := entry.Values["payload"].(string)
+	if !ok {
+		logStructured(WARN, "Progress event without payload: "+entry.ID, nil, 0, false)
+		return true
+	}
+	var imageProcessorProgressMessage ImageProcessorProgressMessage
+	err := json.Unmarshal([]byte(payload), &imageProcessorProgressMessage)
+	if err != nil {
+		fmt.Println("Error parsing message:", err)
+		return true
+	}
+	return handle(imageProcessorProgressMessage)
+}
+
+func (s *RedisEventSubscriber) Report(message ImageProcessorProgressMessage) error {
+	payload, err := jsonStringify(message)
+	if err != nil {
+		return err
+	}
+	return s.client.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: s.options.Stream,
+		Values: map[string]interface{}{"payload": payload},
+	}).Err()
+}
+
+func (s *RedisEventSubscriber) Deliver(message ImageProcessorProgressMessage) error {
+	err := s.appendBacklog(&message)
+	if err != nil {
+		logStructured(ERROR, "Unable to store progress event in backlog", err, 0, false)
+	}
+	payload, err := jsonStringify(message)
+	if err != nil {
+		return err
+	}
+	return s.client.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: progressDeliveryStream,
+		MaxLen: progressDeliveryMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"payload": payload},
+	}).Err()
+}
+
+// FanOut reads every delivered event independently on each replica
+func (s *RedisEventSubscriber) FanOut(handle func(ImageProcessorProgressMessage)) {
+	lastId := "0-0"
+	latest, err := s.client.XRevRangeN(context.Background(), progressDeliveryStream, "+", "-", 1).Result()
+	if err == nil && len(latest) > 0 {
+		lastId = latest[0].ID
+	}
+	for {
+		streams, err := s.client.XRead(context.Background(), &redis.XReadArgs{
+			Streams: []string{progressDeliveryStream, lastId},
+			Count: 100,
+			Block: progressReadBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if errors.Is(err, redis.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logStructured(ERROR, "Unable to read progress delivery stream", err, 0, false)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, entry := range streams[0].Messages {
+			lastId = entry.ID
+			payload, ok := entry.Values["payload"].(string)
+			if !ok {
+				continue
+			}
+			var imageProcessorProgressMessage ImageProcessorProgressMessage
+			err := json.Unmarshal([]byte(payload), &imageProcessorProgressMessage)
+			if err != nil {
+				fmt.Println("Error parsing message:", err)
+				continue
+			}
+			handle(imageProcessorProgressMessage)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Interval of comment lines keeping idle SSE connections open through proxies
+	sseHeartbeatInterval = 15 * time.Second
+	// Reconnect delay suggested to EventSource clients in milliseconds
+	sseRetryMillis = 3000
+)
+
+// streamImageEvents is the Server-Sent Events alternative to the websocket progress feed
+func streamImageEvents(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		returnAppError(w, "Streaming is not supported", http.StatusInternalServerError, nil)
+		return
+	}
+	// EventSource sends Last-Event-ID on reconnect, the query parameter allows resuming on first connect
+	resumeFrom := r.Header.Get("Last-Event-ID")
+	if resumeFrom == "" {
+		resumeFrom = r.URL.Query().Get("since")
+	}
+	since := int64(-1)
+	if resumeFrom != "" {
+		seq, err := parseSequence(resumeFrom)
+		if err != nil {
+			returnAppError(w, "Invalid Last-Event-ID", http.StatusBadRequest, err)
+			return
+		}
+		since = seq
+	}
+
+	client := wsHub.Subscribe(userId)
+	defer wsHub.Unregister(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+
+	lastSeq := int64(0)
+	if since >= 0 {
+		messages, err := loadProgressReplay(userId, since)
+		if err != nil {
+			logStructured(WARN, "Unable to replay SSE backlog for user: "+userId, err, 0, false)
+		}
+		for _, message := range messages {
+			if writeSSEEvent(w, message) != nil {
+				return
+			}
+			lastSeq = message.Sequence()
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message, ok := <-client.Messages():
+			// Closed when the hub dropped us as a slow consumer
+			if !ok {
+				return
+			}
+			if sequenced, isSequenced := message.(sequencedMessage); isSequenced && sequenced.Sequence() != 0 && sequenced.Sequence() <= lastSeq {
+				continue
+			}
+			if writeSSEEvent(w, message) != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSEEvent(w io.Writer, message interface{}) error {
+	data, err := jsonStringify(message)
+	if err != nil {
+		return err
+	}
+	if sequenced, isSequenced := message.(sequencedMessage); isSequenced && sequenced.Sequence() != 0 {
+		_, err = fmt.Fprintf(w, "id: %d\n", sequenced.Sequence())
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
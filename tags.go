@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxTagsPerImage = 20
+	maxTagLength = 50
+	maxDescriptionLength = 2000
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9 _-]*$`)
+
+type TagsBody struct {
+	Tags []string `json:"tags"`
+}
+
+type DescriptionBody struct {
+	Description string `json:"description"`
+}
+
+type TagCount struct {
+	Tag string `json:"tag"`
+	Count int `json:"count"`
+}
+
+// normalizeTags lowercases, validates and deduplicates tags, the result is sorted and never nil
+func normalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("tags must be at most %d letters, digits, spaces, dashes or underscores", maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTagsPerImage {
+		return nil, fmt.Errorf("images can have at most %d tags", maxTagsPerImage)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func validateDescription(description string) (string, error) {
+	description = strings.TrimSpace(description)
+	if len(description) > maxDescriptionLength {
+		return "", fmt.Errorf("description must be at most %d characters", maxDescriptionLength)
+	}
+	return description, nil
+}
+
+// parseImageMetadata reads the optional description and comma separated tags form values of an upload
+func parseImageMetadata(r *http.Request) (string, []string, error) {
+	description, err := validateDescription(r.FormValue("description"))
+	if err != nil {
+		return "", nil, err
+	}
+	tags, err := normalizeTags(splitListParam(r.Form["tags"]))
+	if err != nil {
+		return "", nil, err
+	}
+	return description, tags, nil
+}
+
+func decodeTagsBody(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var body TagsBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		returnAppError(w, "Invalid request body", http.StatusBadRequest, err)
+		return nil, false
+	}
+	tags, err := normalizeTags(body.Tags)
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return nil, false
+	}
+	return tags, true
+}
+
+func writeImageTags(w http.ResponseWriter, tags []string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to update tags", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TagsBody{Tags: tags})
+}
+
+func setImageTags(w http.ResponseWriter, r *http.Request) {
+	tags, ok := decodeTagsBody(w, r)
+	if !ok {
+		return
+	}
+	stored, err := SetImageTags(mux.Vars(r)["image_id"], mux.Vars(r)["user_id"], tags)
+	writeImageTags(w, stored, err)
+}
+
+func addImageTags(w http.ResponseWriter, r *http.Request) {
+	tags, ok := decodeTagsBody(w, r)
+	if !ok {
+		return
+	}
+	imageID := mux.Vars(r)["image_id"]
+	userId := mux.Vars(r)["user_id"]
+	imageResponse, err := GetImageById(imageID, userId)
+	if err != nil {
+		writeImageTags(w, nil, err)
+		return
+	}
+	_, err = normalizeTags(append(imageResponse.Image.Tags, tags...))
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	stored, err := AddImageTags(imageID, userId, tags)
+	writeImageTags(w, stored, err)
+}
+
+func removeImageTag(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(strings.TrimSpace(mux.Vars(r)["tag"]))
+	stored, err := RemoveImageTag(mux.Vars(r)["image_id"], mux.Vars(r)["user_id"], tag)
+	writeImageTags(w, stored, err)
+}
+
+func getUserTags(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	tags, err := GetUserTags(userId)
+	if err != nil {
+		returnAppError(w, "Unable to get tags", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+func setImageDescription(w http.ResponseWriter, r *http.Request) {
+	var body DescriptionBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		returnAppError(w, "Invalid request body", http.StatusBadRequest, err)
+		return
+	}
+	body.Description, err = validateDescription(body.Description)
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	err = SetImageDescription(mux.Vars(r)["image_id"], mux.Vars(r)["user_id"], body.Description)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to update description", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func searchImages(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	tags, err := normalizeTags(splitListParam(r.URL.Query()["tags"]))
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	if text == "" && len(tags) == 0 {
+		returnAppError(w, "q or tags is required", http.StatusBadRequest, nil)
+		return
+	}
+	skip, limit, err := parsePageParams(r.URL.Query())
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	imagesResponse, err := SearchImages(userId, text, tags, skip, limit)
+	if err != nil {
+		returnAppError(w, "Unable to search images", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imagesResponse)
+}
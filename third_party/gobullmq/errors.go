@@ -0,0 +1,5 @@
+package gobullmq
+
+var (
+	RateLimitError = "bullmq:rateLimitExceeded"
+)
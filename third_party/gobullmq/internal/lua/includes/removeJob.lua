@@ -0,0 +1,13 @@
+--[[
+  Function to remove job.
+]]
+
+-- Includes
+--- @include "removeParentDependencyKey"
+
+local function removeJob(jobId, hard, baseKey)
+  local jobKey = baseKey .. jobId
+  removeParentDependencyKey(jobKey, hard, nil, baseKey)
+  rcall("DEL", jobKey, jobKey .. ':logs',
+    jobKey .. ':dependencies', jobKey .. ':processed')
+end
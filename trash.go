@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type TrashPurgerOptions struct {
+	Interval time.Duration
+	// Trashed images are purged once they were in the trash for this long
+	Retention time.Duration
+	// Maximum number of images purged per run
+	BatchSize int
+}
+
+// StartTrashPurger periodically removes the rows and objects of images whose retention expired
+func StartTrashPurger(options TrashPurgerOptions) {
+	fmt.Println("Trash purger started, keeping trashed images for", options.Retention)
+	go func() {
+		ticker := time.NewTicker(options.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			purgeTrash(options)
+		}
+	}()
+}
+
+func purgeTrash(options TrashPurgerOptions) {
+	images, err := GetExpiredTrash(time.Now().Add(-options.Retention), options.BatchSize)
+	if err != nil {
+		logStructured(ERROR, "Unable to load expired trash", err, 0, false)
+		return
+	}
+	purged := 0
+	for _, image := range images {
+		err = purgeImage(image)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			logStructured(ERROR, "Unable to purge image: "+image.ImageID, err, 0, false)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		logStructured(INFO, fmt.Sprintf("Purged %d images from the trash", purged), nil, 0, false)
+	}
+}
+
+// purgeImage permanently deletes a trashed image.
+// Rows go first so a concurrent restore either wins or finds nothing, objects left behind by a failure are only logged.
+func purgeImage(image ImageSchema) error {
+	err := DeleteImage(image.ImageID)
+	if err != nil {
+		return err
+	}
+	// Every version of the original, thumbnail and compressed image lives below the image's folders
+	for _, folder := range []ImageProcessorFolder{Uploads, Thumbnail, Resized} {
+		prefix := fmt.Sprintf("%s/%s/%s/", folder, image.UserId, image.ImageID)
+		err = DeleteFolderFromS3(prefix)
+		if err != nil {
+			logStructured(ERROR, "Unable to delete objects of purged image: "+prefix, err, 0, false)
+		}
+	}
+	return nil
+}
+
+// deleteImage moves an image to the trash, its pending job is cancelled
+func deleteImage(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	imageID := mux.Vars(r)["image_id"]
+	if userId == "" || imageID == "" {
+		returnAppError(w, "User ID or image ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	image, err := TrashImage(imageID, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to delete image", http.StatusInternalServerError, err)
+		return
+	}
+	status := JobStatus(image.JOB_STATUS)
+	if status == JobInQueue || status == JobProcessing {
+		err = stopImageJob(image)
+		// The job finished in the meantime
+		if errors.Is(err, ErrIllegalJobTransition) {
+			err = nil
+		}
+		if err != nil {
+			logStructured(ERROR, "Unable to cancel job of deleted image: "+imageID, err, 0, false)
+		} else {
+			image.JOB_STATUS = string(JobCancelled)
+		}
+	}
+	logStructured(INFO, "Image moved to trash: "+imageID, nil, http.StatusOK, false)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(image)
+}
+
+// getTrash lists trashed images with the same filters, sorting and paging as the images listing
+func getTrash(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	query, err := parseImageListQuery(r)
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, nil)
+		return
+	}
+	query.Trashed = true
+	imagesResponse, err := GetImagesByUserId(userId, query)
+	if err != nil {
+		returnAppError(w, "Unable to get trash", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imagesResponse)
+}
+
+// restoreImage takes an image out of the trash, cancelled jobs stay cancelled until the image is reprocessed
+func restoreImage(w http.ResponseWriter, r *http.Request) {
+	image, err := RestoreImage(mux.Vars(r)["image_id"], mux.Vars(r)["user_id"])
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found in trash", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to restore image", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(image)
+}
+
+// purgeTrashedImage permanently deletes a trashed image without waiting for the retention period
+func purgeTrashedImage(w http.ResponseWriter, r *http.Request) {
+	image, err := GetTrashedImage(mux.Vars(r)["image_id"], mux.Vars(r)["user_id"])
+	if err == nil {
+		err = purgeImage(image)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found in trash", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to purge image", http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
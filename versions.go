@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var ErrImageProcessing = errors.New("image is being processed")
+
+type ImageVersion struct {
+	ImageID string `json:"image_id"`
+	Version int `json:"version"`
+	Filename string `json:"filename"`
+	Size int `json:"size"`
+	Format string `json:"format"`
+	Width int `json:"width"`
+	Height int `json:"height"`
+	CreatedAt time.Time `json:"created_at"`
+	Current bool `json:"current"`
+}
+
+// imageObjectName returns the path of a version's objects below the image's folders.
+// The first version keeps the layout used before versioning, later ones are stored under v{n}/.
+func imageObjectName(filename string, version int) string {
+	if version <= 1 {
+		return filename
+	}
+	return fmt.Sprintf("v%d/%s", version, filename)
+}
+
+func imageVersionOf(image ImageSchema, version int, createdAt time.Time) ImageVersion {
+	return ImageVersion{
+		ImageID: image.ImageID,
+		Version: version,
+		Filename: image.Filename,
+		Size: image.Size,
+		Format: image.Format,
+		Width: image.Width,
+		Height: image.Height,
+		CreatedAt: createdAt,
+	}
+}
+
+// activateImageVersion switches the image to the version and enqueues its compression.
+// The previous job is removed first: the new job reuses the image ID and would be deduplicated against it,
+// and its completion would mark the new version completed. A job still held by a worker leaves the image unchanged.
+func activateImageVersion(w http.ResponseWriter, userId string, version ImageVersion, reason string) {
+	err := RemoveJob(version.ImageID)
+	if err != nil {
+		logStructured(WARN, "Unable to remove previous job for image: "+version.ImageID, err, http.StatusConflict, false)
+		returnAppError(w, "Image is being processed, cancel it or wait for it to finish", http.StatusConflict, nil)
+		return
+	}
+	// A cancellation left by an earlier run would make the executor skip the new job
+	err = ClearCancellation(version.ImageID)
+	if err != nil {
+		returnAppError(w, "Unable to clear previous cancellation", http.StatusInternalServerError, err)
+		return
+	}
+	image, err := SetImageVersion(userId, version, reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if errors.Is(err, ErrImageProcessing) {
+		returnAppError(w, "Image is being processed, cancel it or wait for it to finish", http.StatusConflict, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to update image version", http.StatusInternalServerError, err)
+		return
+	}
+	err = enqueueImageJob(image.ImageID, image.UserId, imageObjectName(image.Filename, image.Version), image.ProcessingOptions, image.ScheduledAt)
+	if err != nil {
+		// The reconciler enqueues the job again once the image is stuck in queue
+		logStructured(ERROR, "Failed to publish message", err, 0, false)
+	}
+	NotifyProgress(ImageProcessorProgressMessage{
+		ImageID: image.ImageID,
+		UserId: image.UserId,
+		Filename: image.Filename,
+		Status: string(JobInQueue),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", imageETag(image))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(image)
+}
+
+// replaceImage uploads a new original for an existing image, keeping its ID, metadata and albums
+func replaceImage(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	imageID := mux.Vars(r)["image_id"]
+	if userId == "" || imageID == "" {
+		returnAppError(w, "User ID or image ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	file, err := parseFileFromForm(r, 10 << 20)
+	if err != nil {
+		returnAppError(w, "Unable to parse file", http.StatusBadRequest, err)
+		return
+	}
+	defer file.File.Close()
+	imageInfo, err := parseImageFromFile(file)
+	if err != nil {
+		returnAppError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	number, err := ReserveImageVersion(imageID, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to create image version", http.StatusInternalServerError, err)
+		return
+	}
+	err = storeImageFiles(file, userId, imageID, imageObjectName(imageInfo.Filename, number))
+	if err != nil {
+		returnAppError(w, "Unable to save file to storage", http.StatusInternalServerError, err)
+		return
+	}
+	version := ImageVersion{
+		ImageID: imageID,
+		Version: number,
+		Filename: imageInfo.Filename,
+		Size: imageInfo.Size,
+		Format: imageInfo.Format,
+		Width: imageInfo.Width,
+		Height: imageInfo.Height,
+		CreatedAt: time.Now(),
+	}
+	logStructured(INFO, fmt.Sprintf("Image %s replaced with version %d: %s (%.2f KB)", imageID, number, imageInfo.Filename, float64(imageInfo.Size)/1024), nil, 200, false)
+	activateImageVersion(w, userId, version, fmt.Sprintf("replaced with version %d", number))
+}
+
+func getImageVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := GetImageVersions(mux.Vars(r)["image_id"], mux.Vars(r)["user_id"])
+	if err != nil {
+		returnAppError(w, "Unable to get image versions", http.StatusInternalServerError, err)
+		return
+	}
+	if len(versions) == 0 {
+		returnAppError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// restoreImageVersion makes a previous version current again, its objects are still in storage
+func restoreImageVersion(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	number, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil || number < 1 {
+		returnAppError(w, "Invalid version", http.StatusBadRequest, nil)
+		return
+	}
+	version, err := GetImageVersion(mux.Vars(r)["image_id"], userId, number)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnAppError(w, "Image version not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "Unable to get image version", http.StatusInternalServerError, err)
+		return
+	}
+	if version.Current {
+		returnAppError(w, "Version is already current", http.StatusConflict, nil)
+		return
+	}
+	activateImageVersion(w, userId, version, fmt.Sprintf("restored version %d", number))
+}
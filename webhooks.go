@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	WebhookImageCompleted = "image.completed"
+	WebhookImageFailed = "image.failed"
+)
+
+const (
+	WebhookDeliveryPending = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed = "failed"
+)
+
+const (
+	// Length in bytes of generated signing secrets
+	webhookSecretSize = 32
+	webhookMaxRedirects = 3
+	defaultWebhookDeliveriesLimit = 50
+	maxWebhookDeliveriesLimit = 200
+)
+
+type Webhook struct {
+	ID string `json:"id"`
+	UserId string `json:"user_id"`
+	URL string `json:"url"`
+	// Only returned when the webhook is created
+	Secret string `json:"secret,omitempty"`
+	Events []string `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookBody struct {
+	URL string `json:"url"`
+	// Generated when empty
+	Secret string `json:"secret"`
+	Events []string `json:"events"`
+}
+
+type WebhookEventData struct {
+	ImageID string `json:"image_id"`
+	UserId string `json:"user_id"`
+	Filename string `json:"filename"`
+	Status string `json:"status"`
+	CompressedSize int64 `json:"compressed_size,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// WebhookPayload is the JSON body posted to webhook URLs
+type WebhookPayload struct {
+	Event string `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data WebhookEventData `json:"data"`
+}
+
+type WebhookDelivery struct {
+	ID int64 `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	Event string `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+	Status string `json:"status"`
+	Attempts int `json:"attempts"`
+	ResponseStatus sql.NullInt64 `json:"response_status"`
+	LastError sql.NullString `json:"last_error"`
+	LastAttemptAt sql.NullTime `json:"last_attempt_at"`
+	NextAttemptAt sql.NullTime `json:"next_attempt_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// webhookDeliveryTask is a claimed delivery with what is needed to send it
+type webhookDeliveryTask struct {
+	ID int64
+	Event string
+	Payload string
+	Attempts int
+	URL string
+	Secret string
+}
+
+type WebhookDispatcherOptions struct {
+	Interval time.Duration
+	BatchSize int
+	// Deliveries are marked failed after this many attempts
+	MaxAttempts int
+	// Delay before the second attempt, doubled for every further attempt
+	Backoff time.Duration
+	Timeout time.Duration
+}
+
+func IsKnownWebhookEvent(event string) bool {
+	return event == WebhookImageCompleted || event == WebhookImageFailed
+}
+
+// webhookEventForStatus returns the webhook event reported when a job moves to status
+func webhookEventForStatus(status JobStatus) (string, bool) {
+	switch status {
+	case JobCompleted:
+		return WebhookImageCompleted, true
+	case JobFailed:
+		return WebhookImageFailed, true
+	}
+	return "", false
+}
+
+// signWebhookPayload signs "<timestamp>.<payload>" so receivers can reject replayed deliveries
+func signWebhookPayload(secret string, timestamp int64, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", timestamp, payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// StartWebhookDispatcher sends pending deliveries in the background.
+// Deliveries are claimed with SKIP LOCKED so every replica can run a dispatcher.
+func StartWebhookDispatcher(options WebhookDispatcherOptions) {
+	// Webhook URLs are user supplied, they must not reach internal services
+	client := newAddressCheckedClient(options.Timeout, webhookMaxRedirects, isPublicAddress)
+	fmt.Println("Webhook dispatcher started")
+	go func() {
+		ticker := time.NewTicker(options.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			dispatchWebhooks(client, options)
+		}
+	}()
+}
+
+// dispatchWebhooks sends up to BatchSize due deliveries.
+// They are claimed one at a time right before sending, a lease covering a whole batch sent one after another
+// would expire while deliveries wait their turn and let other dispatchers send them again.
+func dispatchWebhooks(client *http.Client, options WebhookDispatcherOptions) {
+	for i := 0; i < options.BatchSize; i++ {
+		// A claimed delivery is retried by any dispatcher once the lease expires, e.g. after a crash
+		task, err := ClaimWebhookDelivery(time.Now().Add(2*options.Timeout))
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			logStructured(ERROR, "Unable to claim webhook delivery", err, 0, false)
+			return
+		}
+		deliverWebhook(client, task, options)
+	}
+}
+
+func deliverWebhook(client *http.Client, task webhookDeliveryTask, options WebhookDispatcherOptions) {
+	responseStatus, err := postWebhook(client, task)
+	attempts := task.Attempts + 1
+	status := WebhookDeliverySucceeded
+	lastError := sql.NullString{}
+	nextAttemptAt := sql.NullTime{}
+	if err != nil {
+		lastError = sql.NullString{String: webhookErrorMessage(responseStatus, err), Valid: true}
+		status = WebhookDeliveryFailed
+		if attempts < options.MaxAttempts {
+			status = WebhookDeliveryPending
+			nextAttemptAt = sql.NullTime{Time: time.Now().Add(options.Backoff << (attempts - 1)), Valid: true}
+		}
+		logStructured(WARN, fmt.Sprintf("Webhook delivery %d failed on attempt %d", task.ID, attempts), err, 0, false)
+	}
+	err = RecordWebhookAttempt(task.ID, status, responseStatus, lastError, nextAttemptAt)
+	if err != nil {
+		logStructured(ERROR, fmt.Sprintf("Unable to record webhook delivery %d", task.ID), err, 0, false)
+	}
+}
+
+// postWebhook sends the delivery, any status outside 2xx is an error
+func postWebhook(client *http.Client, task webhookDeliveryTask) (sql.NullInt64, error) {
+	request, err := http.NewRequest(http.MethodPost, task.URL, bytes.NewBufferString(task.Payload))
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Webhook-Event", task.Event)
+	request.Header.Set("X-Webhook-Delivery", strconv.FormatInt(task.ID, 10))
+	request.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	request.Header.Set("X-Webhook-Signature", "sha256="+signWebhookPayload(task.Secret, timestamp, task.Payload))
+	response, err := client.Do(request)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	defer response.Body.Close()
+	responseStatus := sql.NullInt64{Int64: int64(response.StatusCode), Valid: true}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return responseStatus, fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	return responseStatus, nil
+}
+
+// webhookErrorMessage is the error users see in the delivery log.
+// Response bodies and connection errors could reveal internal services, only the log has them.
+func webhookErrorMessage(responseStatus sql.NullInt64, err error) string {
+	var netErr net.Error
+	switch {
+	case responseStatus.Valid:
+		return fmt.Sprintf("unexpected status %d", responseStatus.Int64)
+	case errors.Is(err, ErrAddressNotAllowed):
+		return "address is not allowed"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "request timed out"
+	}
+	return "request failed"
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, webhookSecretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	var body WebhookBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		returnAppError(w, "Invalid request body", http.StatusBadRequest, err)
+		return
+	}
+	webhookURL, err := url.Parse(body.URL)
+	if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+		returnAppError(w, "URL must be an absolute http or https URL", http.StatusBadRequest, nil)
+		return
+	}
+	err = checkHostAddresses(r.Context(), webhookURL.Hostname(), isPublicAddress)
+	if errors.Is(err, ErrAddressNotAllowed) {
+		returnAppError(w, "URL must not point to a loopback, private or reserved address", http.StatusBadRequest, nil)
+		return
+	}
+	if err != nil {
+		returnAppError(w, "URL host cannot be resolved", http.StatusBadRequest, nil)
+		return
+	}
+	if len(body.Events) == 0 {
+		body.Events = []string{WebhookImageCompleted, WebhookImageFailed}
+	}
+	for _, event := range body.Events {
+		if !IsKnownWebhookEvent(event) {
+			returnAppError(w, "Events must be image.completed or image.failed", http.StatusBadRequest, nil)
+			return
+		}
+	}
+	if body.Secret == "" {
+		body.Secret, err = generateWebhookSecret()
+		if err != nil {
+			returnAppError(w, "Unable to generate secret", http.StatusInternalServerError, err)
+			return
+		}
+	}
+	webhook := Webhook{
+		ID: uuid.New().String(),
+		UserId: userId,
+		URL: body.URL,
+		Secret: body.Secret,
+		Events: body.Events,
+		CreatedAt: time.Now(),
+	}
+	err = InsertWebhook(webhook)
+	if err != nil {
+		returnAppError(w, "Unable to save webhook", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func getWebhooks(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	if userId == "" {
+		returnAppError(w, "User ID is missing", http.StatusBadRequest, nil)
+		return
+	}
+	webhooks, err := GetWebhooks(userId)
+	if err != nil {
+		returnAppError(w, "Unable to get webhooks", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	webhookId := mux.Vars(r)["webhook_id"]
+	deleted, err := DeleteWebhook(webhookId, userId)
+	if err != nil {
+		returnAppError(w, "Unable to delete webhook", http.StatusInternalServerError, err)
+		return
+	}
+	if !deleted {
+		returnAppError(w, "Webhook not found", http.StatusNotFound, nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	webhookId := mux.Vars(r)["webhook_id"]
+	limit := defaultWebhookDeliveriesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxWebhookDeliveriesLimit {
+			returnAppError(w, fmt.Sprintf("Limit must be between 1 and %d", maxWebhookDeliveriesLimit), http.StatusBadRequest, nil)
+			return
+		}
+		limit = parsed
+	}
+	deliveries, err := GetWebhookDeliveries(webhookId, userId, limit)
+	if err != nil {
+		returnAppError(w, "Unable to get webhook deliveries", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	webhookId := mux.Vars(r)["webhook_id"]
+	deliveryId, err := strconv.ParseInt(mux.Vars(r)["delivery_id"], 10, 64)
+	if err != nil {
+		returnAppError(w, "Invalid delivery ID", http.StatusBadRequest, nil)
+		return
+	}
+	found, err := RedeliverWebhook(deliveryId, webhookId, userId)
+	if err != nil {
+		returnAppError(w, "Unable to redeliver webhook", http.StatusInternalServerError, err)
+		return
+	}
+	if !found {
+		returnAppError(w, "Delivery not found", http.StatusNotFound, nil)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}